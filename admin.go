@@ -0,0 +1,171 @@
+package mariadbstore
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// SessionInfo describes a stored session as returned by ListSessions.
+type SessionInfo struct {
+	ID         string
+	Name       string
+	Created    time.Time
+	LastActive time.Time
+	Expires    time.Time
+
+	// Updated, IP and UserAgent are only set with WithSessionMetadata.
+	// Updated is when the values were last saved and IP and UserAgent
+	// describe the request that last saved the session.
+	Updated   time.Time
+	IP        string
+	UserAgent string
+
+	// Deleted is when the session was soft deleted. It is only set for the
+	// sessions ListOptions.IncludeDeleted lists.
+	Deleted time.Time
+
+	// Values holds the decoded session values. It is nil when the row can't
+	// be decoded with the store's serializer and keyring.
+	Values map[interface{}]interface{}
+}
+
+// ListOptions controls which sessions ListSessions returns.
+type ListOptions struct {
+	// Limit is the maximum number of sessions to return. Zero means no limit.
+	Limit int
+	// Offset is the number of sessions to skip.
+	Offset int
+	// IncludeExpired also returns sessions that have expired but haven't
+	// been purged yet.
+	IncludeExpired bool
+	// IncludeDeleted also returns sessions soft deleted with WithSoftDelete
+	// within the grace period. Without soft deletes it has no effect.
+	IncludeDeleted bool
+}
+
+// ListSessions returns the stored sessions ordered by ID.
+func (s *MariadbStore) ListSessions(opts ListOptions) ([]SessionInfo, error) {
+	if err := s.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var minExpires int64
+	if !opts.IncludeExpired {
+		minExpires = now.Unix()
+	}
+
+	var limit int64 = math.MaxInt64
+	if opts.Limit > 0 {
+		limit = int64(opts.Limit)
+	}
+
+	args := append([]any{minExpires}, s.listArgs(opts.IncludeDeleted, now)...)
+	rows, err := s.readRows(context.Background(), s.readListStmt, s.listStmt, append(args, limit, opts.Offset)...)
+	if err != nil {
+		return nil, s.dbError(context.Background(), "list", "", err)
+	}
+	defer rows.Close()
+
+	var infos []SessionInfo
+	for rows.Next() {
+		info, err := s.scanInfo(rows)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, rows.Err()
+}
+
+// GetSessionByID returns the session with the given ID, even if it has
+// expired but hasn't been purged yet. It returns ErrSessionNotFound if there
+// is no such session.
+func (s *MariadbStore) GetSessionByID(id string) (SessionInfo, error) {
+	if err := s.checkOpen(); err != nil {
+		return SessionInfo{}, err
+	}
+
+	ctx := context.Background()
+	rows, err := s.db.QueryContext(ctx, s.sql(`SELECT {id}, {name}, {created_at}, {last_active}, {expires}, {session_data}`+s.metaSelect()+s.deletedSelect()+` FROM {table} WHERE {id}=?{live}`), id)
+	if err != nil {
+		return SessionInfo{}, s.dbError(ctx, "get", id, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return SessionInfo{}, err
+		}
+		return SessionInfo{}, ErrSessionNotFound
+	}
+	return s.scanInfo(rows)
+}
+
+// scanInfo reads a row selected with the listing columns.
+func (s *MariadbStore) scanInfo(rows *sql.Rows) (SessionInfo, error) {
+	var info SessionInfo
+	var created, lastActive, expires, updated, deleted int64
+	var sessionData []byte
+	dest := []any{&info.ID, &info.Name, &created, &lastActive, &expires, &sessionData}
+	if s.metadata {
+		dest = append(dest, &updated, &info.IP, &info.UserAgent)
+	}
+	if s.softDelete > 0 {
+		dest = append(dest, &deleted)
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return SessionInfo{}, err
+	}
+
+	if created > 0 {
+		info.Created = time.Unix(created, 0)
+	}
+	if lastActive > 0 {
+		info.LastActive = time.Unix(lastActive, 0)
+	}
+	if updated > 0 {
+		info.Updated = time.Unix(updated, 0)
+	}
+	if deleted > 0 {
+		info.Deleted = time.Unix(deleted, 0)
+	}
+	info.Expires = time.Unix(expires, 0)
+
+	session := sessions.NewSession(s, info.Name)
+	if err := s.decode(sessionData, session); err == nil {
+		info.Values = session.Values
+	}
+	return info, nil
+}
+
+// DeleteSessionByID removes the session with the given ID from the store. It
+// returns ErrSessionNotFound if there is no such session, and
+// ErrStoreDraining after Drain was called.
+func (s *MariadbStore) DeleteSessionByID(id string) error {
+	if err := s.checkOpen(); err != nil {
+		return err
+	}
+	if err := s.drain.beginWrite(); err != nil {
+		return err
+	}
+	defer s.drain.endWrite()
+	return s.erase(context.Background(), id)
+}
+
+// Count returns the number of sessions that haven't expired.
+func (s *MariadbStore) Count() (int64, error) {
+	if err := s.checkOpen(); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if err := s.readRow(context.Background(), s.readCountStmt, s.countStmt, []any{&count}, time.Now().Unix()); err != nil {
+		return 0, s.dbError(context.Background(), "count", "", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,51 @@
+package mariadbstore
+
+import (
+	"context"
+	"fmt"
+)
+
+// auditEvent names the kinds of changes recorded in the audit table.
+type auditEvent string
+
+const (
+	auditCreate  auditEvent = "create"
+	auditRefresh auditEvent = "refresh"
+	auditDelete  auditEvent = "delete"
+	auditExpire  auditEvent = "expire"
+)
+
+func (s *MariadbStore) auditTable() string {
+	return s.qualified(s.auditName)
+}
+
+// createAuditTable creates the audit table used with WithAuditLog.
+func (s *MariadbStore) createAuditTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, s.sql(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS {audit_table} (
+			id BIGINT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+			session_id VARCHAR(128) NOT NULL,
+			event VARCHAR(16) NOT NULL,
+			user_id VARCHAR(255) NOT NULL DEFAULT '',
+			client_ip VARCHAR(45) NOT NULL DEFAULT '',
+			user_agent VARCHAR(512) NOT NULL DEFAULT '',
+			occurred_at INT NOT NULL,
+			INDEX (session_id),
+			INDEX (occurred_at)
+		) ENGINE=%s
+	`, s.engine)))
+	return err
+}
+
+// audit records an event in the audit table. Inside a transaction the record
+// is committed or rolled back with the change. A failed insert is logged but
+// doesn't fail the change being audited.
+func (s *MariadbStore) audit(ctx context.Context, kind auditEvent, e SessionEvent) {
+	if s.auditStmt == nil {
+		return
+	}
+	_, err := s.execStmt(ctx, s.auditStmt, e.ID, string(kind), e.UserID, e.IP, e.UserAgent, e.Time.Unix())
+	if err != nil {
+		s.dbError(ctx, "audit", e.ID, err)
+	}
+}
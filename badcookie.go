@@ -0,0 +1,48 @@
+package mariadbstore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gorilla/securecookie"
+)
+
+// BadCookiePolicy sets how New handles session cookies that can't be decoded
+// and sessions whose stored data can't be decoded. Either way New replaces
+// the session with a new one.
+type BadCookiePolicy struct {
+	// Report makes New return ErrBadCookie, wrapping the decode error,
+	// along with the new session.
+	Report bool
+	// DeleteOrphans deletes the stored session a valid cookie names when
+	// its data can't be decoded, instead of keeping it until it expires.
+	DeleteOrphans bool
+	// LegacyCodecs are tried when the store's codecs can't decode a cookie
+	// or stored data, e.g. codecs with retired keys. Sessions they decode
+	// are re-encoded with the store's codecs when they're saved.
+	LegacyCodecs []securecookie.Codec
+}
+
+// decodeValue decodes a cookie or stored value signed for signedName with
+// codecs, falling back to the legacy codecs.
+func (s *MariadbStore) decodeValue(signedName, value string, dst any, codecs []securecookie.Codec) error {
+	err := securecookie.DecodeMulti(signedName, value, dst, codecs...)
+	if err == nil || len(s.badCookie.LegacyCodecs) == 0 {
+		return err
+	}
+	if securecookie.DecodeMulti(signedName, value, dst, s.badCookie.LegacyCodecs...) == nil {
+		return nil
+	}
+	return err
+}
+
+// deleteOrphan deletes the row of a session whose data can't be decoded,
+// which no cookie can load anymore.
+func (s *MariadbStore) deleteOrphan(ctx context.Context, id string) {
+	if !s.badCookie.DeleteOrphans || id == "" {
+		return
+	}
+	if err := s.erase(ctx, id); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		s.log(ctx, s.logLevels.DB, "orphaned session delete failed", "session_id", id, "error", err)
+	}
+}
@@ -0,0 +1,75 @@
+package mariadbstore
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+func TestBadCookieReport(t *testing.T) {
+	s, _ := newFakeStore(t, WithBadCookiePolicy(BadCookiePolicy{Report: true}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: "garbage"})
+	session, err := s.New(r, "session")
+	if !errors.Is(err, ErrBadCookie) || !errors.Is(err, ErrDecodeFailed) {
+		t.Errorf("New = %v, want ErrBadCookie wrapping ErrDecodeFailed", err)
+	}
+	if session == nil || !session.IsNew {
+		t.Errorf("New returned %v, want a new session", session)
+	}
+}
+
+// serveGarbage makes db return a row whose data can't be decoded.
+func serveGarbage(db *fakeDB) {
+	now := time.Now().Unix()
+	db.setHandler(func(query string, args []driver.Value) (fakeResult, error) {
+		if !strings.HasPrefix(query, "SELECT `created_at`, `last_active`, `expires`, `session_data`") {
+			return fakeResult{rowsAffected: 1}, nil
+		}
+		return fakeResult{
+			columns: []string{"created_at", "last_active", "expires", "session_data"},
+			rows:    [][]driver.Value{{now, now, now + 3600, []byte("garbage")}},
+		}, nil
+	})
+}
+
+func TestBadCookieDeleteOrphans(t *testing.T) {
+	for _, deleteOrphans := range []bool{false, true} {
+		s, db := newFakeStore(t, WithBadCookiePolicy(BadCookiePolicy{DeleteOrphans: deleteOrphans}))
+		serveGarbage(db)
+		session, err := s.New(requestWithSession(t, s, "session", "5"), "session")
+		if err != nil || session.ID == "5" {
+			t.Fatalf("New = %q, %v, want a new session", session.ID, err)
+		}
+		_, args := db.ran("DELETE")
+		if deleted := len(args) == 1 && args[0][0] == "5"; deleted != deleteOrphans {
+			t.Errorf("with DeleteOrphans %v the orphaned row was deleted: %v", deleteOrphans, args)
+		}
+	}
+}
+
+func TestBadCookieLegacyCodecs(t *testing.T) {
+	legacy := securecookie.CodecsFromPairs([]byte("retired"))
+	s, db := newFakeStore(t, WithBadCookiePolicy(BadCookiePolicy{LegacyCodecs: legacy}))
+	serveRow(t, s, db, map[interface{}]interface{}{"user": "alice"}, time.Now().Add(time.Hour))
+
+	encoded, err := securecookie.EncodeMulti(s.cookieName("session"), "5", legacy...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: encoded})
+	session, err := s.New(r, "session")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if session.IsNew || session.ID != "5" || session.Values["user"] != "alice" {
+		t.Errorf("cookie of a retired key loaded %q %v, new %v", session.ID, session.Values, session.IsNew)
+	}
+}
@@ -0,0 +1,74 @@
+package mariadbstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// BindingPolicy binds sessions to the client that created them. A session
+// loaded by a client whose fingerprint doesn't match is rejected with
+// ErrSessionHijackSuspected.
+type BindingPolicy struct {
+	// UserAgent requires the User-Agent header to match.
+	UserAgent bool
+	// IPv4Bits and IPv6Bits are the number of leading bits of the client IP
+	// that must match, e.g. 24 to allow clients to move within a /24. Zero
+	// doesn't bind to the IP address.
+	IPv4Bits int
+	IPv6Bits int
+}
+
+func (p BindingPolicy) enabled() bool {
+	return p.UserAgent || p.IPv4Bits > 0 || p.IPv6Bits > 0
+}
+
+func (p BindingPolicy) validate() error {
+	if p.IPv4Bits < 0 || p.IPv4Bits > 32 {
+		return errors.New("IPv4 bits must be between 0 and 32")
+	}
+	if p.IPv6Bits < 0 || p.IPv6Bits > 128 {
+		return errors.New("IPv6 bits must be between 0 and 128")
+	}
+	return nil
+}
+
+// fingerprint hashes the parts of the client covered by the policy. A
+// client IP that doesn't parse, and so has no address family, is bound as
+// it is when either family is bound.
+func (p BindingPolicy) fingerprint(ip string, r *http.Request) []byte {
+	h := sha256.New()
+	if parsed := net.ParseIP(ip); parsed == nil {
+		if p.IPv4Bits > 0 || p.IPv6Bits > 0 {
+			h.Write([]byte(ip))
+		}
+	} else if v4 := parsed.To4(); v4 != nil {
+		if p.IPv4Bits > 0 {
+			h.Write(v4.Mask(net.CIDRMask(p.IPv4Bits, 32)))
+		}
+	} else if p.IPv6Bits > 0 {
+		h.Write(parsed.Mask(net.CIDRMask(p.IPv6Bits, 128)))
+	}
+	h.Write([]byte{0})
+	if p.UserAgent {
+		h.Write([]byte(r.UserAgent()))
+	}
+	return h.Sum(nil)
+}
+
+// checkBinding compares a stored fingerprint with the client in ctx. Rows
+// saved before binding was enabled have no fingerprint and are accepted;
+// they are bound on their next save.
+func (s *MariadbStore) checkBinding(ctx context.Context, id string, stored []byte) error {
+	if !s.binding.enabled() || len(stored) == 0 {
+		return nil
+	}
+	if subtle.ConstantTimeCompare(stored, clientFrom(ctx).fingerprint) == 1 {
+		return nil
+	}
+	s.log(ctx, s.logLevels.Decode, "session fingerprint mismatch", "session_id", id)
+	return ErrSessionHijackSuspected
+}
@@ -0,0 +1,35 @@
+package mariadbstore
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBindingFingerprint(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("User-Agent", "browser")
+
+	agent := BindingPolicy{UserAgent: true}
+	if !bytes.Equal(agent.fingerprint("unix-socket", r), agent.fingerprint("", r)) {
+		t.Error("client IP changes the fingerprint without IP binding")
+	}
+	if !bytes.Equal(agent.fingerprint("192.0.2.1", r), agent.fingerprint("2001:db8::1", r)) {
+		t.Error("client IP changes the fingerprint without IP binding")
+	}
+
+	ipv4 := BindingPolicy{IPv4Bits: 24}
+	if !bytes.Equal(ipv4.fingerprint("192.0.2.1", r), ipv4.fingerprint("192.0.2.200", r)) {
+		t.Error("addresses in the same /24 have different fingerprints")
+	}
+	if bytes.Equal(ipv4.fingerprint("192.0.2.1", r), ipv4.fingerprint("198.51.100.1", r)) {
+		t.Error("addresses in different /24s have the same fingerprint")
+	}
+	if !bytes.Equal(ipv4.fingerprint("2001:db8::1", r), ipv4.fingerprint("2001:db8:1::1", r)) {
+		t.Error("IPv6 addresses change the fingerprint with only IPv4 binding")
+	}
+	if bytes.Equal(ipv4.fingerprint("unix-socket", r), ipv4.fingerprint("other", r)) {
+		t.Error("unparseable addresses aren't bound with IP binding")
+	}
+}
@@ -0,0 +1,122 @@
+package mariadbstore
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// sessionRow is a stored session as read by load.
+type sessionRow struct {
+	created    int64
+	lastActive int64
+	expires    int64
+	data       []byte
+	// fingerprint is only read with WithSessionBinding.
+	fingerprint []byte
+	// userID is only read with WithMaxSessionsPerUser.
+	userID string
+	// options is only read with WithPersistedOptions.
+	options string
+}
+
+// rowCache is a size and TTL bounded LRU cache of session rows. A nil cache
+// caches nothing.
+type rowCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+type cacheEntry struct {
+	id     string
+	row    sessionRow
+	stored time.Time
+}
+
+func newRowCache(maxEntries int, ttl time.Duration) *rowCache {
+	return &rowCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached row for id if it is fresh and hasn't expired.
+func (c *rowCache) get(id string, now time.Time) (sessionRow, bool) {
+	if c == nil {
+		return sessionRow{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[id]
+	if !ok {
+		return sessionRow{}, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if now.Sub(entry.stored) > c.ttl || entry.row.expires <= now.Unix() {
+		c.removeElement(el)
+		return sessionRow{}, false
+	}
+	c.ll.MoveToFront(el)
+	return entry.row, true
+}
+
+func (c *rowCache) put(id string, row sessionRow, now time.Time) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[id]; ok {
+		el.Value = &cacheEntry{id: id, row: row, stored: now}
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[id] = c.ll.PushFront(&cacheEntry{id: id, row: row, stored: now})
+	if c.ll.Len() > c.maxEntries {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// touch updates the expiry of a cached row without changing its data.
+func (c *rowCache) touch(id string, lastActive, expires int64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[id]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.row.lastActive = lastActive
+		entry.row.expires = expires
+	}
+}
+
+func (c *rowCache) remove(id string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[id]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *rowCache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*cacheEntry).id)
+}
@@ -0,0 +1,88 @@
+package mariadbstore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRowCacheLRU(t *testing.T) {
+	now := time.Now()
+	row := sessionRow{expires: now.Add(time.Hour).Unix()}
+	c := newRowCache(2, time.Minute)
+	c.put("a", row, now)
+	c.put("b", row, now)
+
+	// a was used last, so b is evicted
+	if _, ok := c.get("a", now); !ok {
+		t.Fatal("a isn't cached")
+	}
+	c.put("c", row, now)
+	if _, ok := c.get("b", now); ok {
+		t.Error("the least recently used row wasn't evicted")
+	}
+	for _, id := range []string{"a", "c"} {
+		if _, ok := c.get(id, now); !ok {
+			t.Errorf("%s was evicted", id)
+		}
+	}
+	if n := c.ll.Len(); n != 2 || len(c.items) != 2 {
+		t.Errorf("cache holds %d rows and %d items, want 2", n, len(c.items))
+	}
+
+	// replacing a row doesn't evict another one
+	c.put("a", sessionRow{expires: row.expires, data: []byte("new")}, now)
+	if got, _ := c.get("a", now); string(got.data) != "new" {
+		t.Errorf("cached data %q, want the replaced row", got.data)
+	}
+	if _, ok := c.get("c", now); !ok {
+		t.Error("replacing a row evicted another one")
+	}
+}
+
+func TestRowCacheTTL(t *testing.T) {
+	now := time.Now()
+	c := newRowCache(10, time.Minute)
+	c.put("a", sessionRow{expires: now.Add(time.Hour).Unix()}, now)
+	c.put("expired", sessionRow{expires: now.Add(30 * time.Second).Unix()}, now)
+
+	if _, ok := c.get("a", now.Add(59*time.Second)); !ok {
+		t.Error("row was dropped before the TTL")
+	}
+	if _, ok := c.get("expired", now.Add(45*time.Second)); ok {
+		t.Error("row of an expired session was returned")
+	}
+	if _, ok := c.get("a", now.Add(2*time.Minute)); ok {
+		t.Error("row was returned after the TTL")
+	}
+	if len(c.items) != 0 {
+		t.Errorf("cache still holds %d stale rows", len(c.items))
+	}
+}
+
+func TestRowCacheTouchAndRemove(t *testing.T) {
+	now := time.Now()
+	c := newRowCache(10, time.Minute)
+	c.put("a", sessionRow{expires: now.Add(10 * time.Second).Unix(), data: []byte("data")}, now)
+
+	expires := now.Add(time.Hour).Unix()
+	c.touch("a", now.Unix(), expires)
+	got, ok := c.get("a", now.Add(20*time.Second))
+	if !ok || got.expires != expires || got.lastActive != now.Unix() || string(got.data) != "data" {
+		t.Errorf("touched row = %+v, %v, want the new expiry and the same data", got, ok)
+	}
+
+	c.remove("a")
+	if _, ok := c.get("a", now); ok {
+		t.Error("removed row is still cached")
+	}
+}
+
+func TestNilRowCache(t *testing.T) {
+	var c *rowCache
+	c.put("a", sessionRow{expires: time.Now().Add(time.Hour).Unix()}, time.Now())
+	c.touch("a", 0, 0)
+	c.remove("a")
+	if _, ok := c.get("a", time.Now()); ok {
+		t.Error("nil cache returned a row")
+	}
+}
@@ -0,0 +1,307 @@
+// Command mariadbsessions inspects and manages the sessions stored by
+// mariadbstore without writing SQL against the sessions table.
+//
+// Usage:
+//
+//	mariadbsessions [flags] list [-limit n] [-offset n] [-expired] [-deleted]
+//	mariadbsessions [flags] inspect <id>
+//	mariadbsessions [flags] count
+//	mariadbsessions [flags] delete <id>...
+//	mariadbsessions [flags] purge
+//
+// The DSN is read from -dsn or MARIADBSESSIONS_DSN and must name the
+// database holding the sessions table. Session values are only shown when
+// the store's key pairs, serializer and encryption keys are given, and
+// list -deleted needs the grace period given with -soft-delete.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/agorman/mariadbstore"
+	"github.com/go-sql-driver/mysql"
+)
+
+// listFlag collects the values of a flag given more than once.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "mariadbsessions:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	var keys, encryptionKeys listFlag
+	flags := flag.NewFlagSet("mariadbsessions", flag.ExitOnError)
+	dsn := flags.String("dsn", os.Getenv("MARIADBSESSIONS_DSN"), "MariaDB DSN naming the sessions database")
+	table := flags.String("table", mariadbstore.DefaultTableName, "sessions table")
+	serializer := flags.String("serializer", "securecookie", "session serializer: securecookie, gob, json or msgpack")
+	metadata := flags.Bool("metadata", false, "show the metadata stored with WithSessionMetadata")
+	softDelete := flags.Duration("soft-delete", 0, "grace period set with WithSoftDelete, needed to list soft deleted sessions")
+	flags.Var(&keys, "key", "cookie key pair, raw or prefixed with hex: or base64: (repeatable)")
+	flags.Var(&encryptionKeys, "encryption-key", "session data encryption key as id:hexkey, primary key first (repeatable)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: mariadbsessions [flags] list|inspect|count|delete|purge [args]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing command")
+	}
+	if *dsn == "" {
+		return errors.New("missing -dsn")
+	}
+
+	opts := []mariadbstore.Option{
+		mariadbstore.WithSkipSchemaCreation(),
+		mariadbstore.WithoutCleanup(),
+	}
+	if len(keys) > 0 {
+		keyPairs := make([][]byte, 0, len(keys))
+		for _, k := range keys {
+			key, err := decodeKey(k)
+			if err != nil {
+				return fmt.Errorf("-key: %w", err)
+			}
+			keyPairs = append(keyPairs, key)
+		}
+		opts = append(opts, mariadbstore.WithKeyPairs(keyPairs...))
+	}
+	if len(encryptionKeys) > 0 {
+		keyring, err := newKeyring(encryptionKeys)
+		if err != nil {
+			return fmt.Errorf("-encryption-key: %w", err)
+		}
+		opts = append(opts, mariadbstore.WithEncryption(keyring))
+	}
+	switch *serializer {
+	case "securecookie":
+	case "gob":
+		opts = append(opts, mariadbstore.WithSerializer(mariadbstore.GobSerializer{}))
+	case "json":
+		opts = append(opts, mariadbstore.WithSerializer(mariadbstore.JSONSerializer{}))
+	case "msgpack":
+		opts = append(opts, mariadbstore.WithSerializer(mariadbstore.MsgpackSerializer{}))
+	default:
+		return fmt.Errorf("unknown serializer %q", *serializer)
+	}
+	if *metadata {
+		opts = append(opts, mariadbstore.WithSessionMetadata(nil))
+	}
+	if *softDelete > 0 {
+		opts = append(opts, mariadbstore.WithSoftDelete(*softDelete))
+	}
+
+	store, err := openStore(*dsn, *table, opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	cmd, cmdArgs := flags.Arg(0), flags.Args()[1:]
+	switch cmd {
+	case "list":
+		return list(store, cmdArgs, *metadata)
+	case "inspect":
+		if len(cmdArgs) != 1 {
+			return errors.New("usage: inspect <id>")
+		}
+		return inspect(store, cmdArgs[0], *metadata)
+	case "count":
+		n, err := store.Count()
+		if err != nil {
+			return err
+		}
+		fmt.Println(n)
+		return nil
+	case "delete":
+		if len(cmdArgs) == 0 {
+			return errors.New("usage: delete <id>...")
+		}
+		for _, id := range cmdArgs {
+			if err := store.DeleteSessionByID(id); err != nil {
+				return fmt.Errorf("session %s: %w", id, err)
+			}
+		}
+		return nil
+	case "purge":
+		n, err := store.CleanExpired(context.Background())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("purged %d expired sessions\n", n)
+		return nil
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+// openStore opens a store on an existing sessions table without creating or
+// migrating it.
+func openStore(dsn, table string, opts []mariadbstore.Option) (*mariadbstore.MariadbStore, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.DBName == "" {
+		return nil, errors.New("dsn must name a database")
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	store, err := mariadbstore.NewMariadbStoreWithOptions(db, cfg.DBName, table, opts...)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+func list(store *mariadbstore.MariadbStore, args []string, metadata bool) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	limit := flags.Int("limit", 50, "maximum number of sessions to list, 0 for all")
+	offset := flags.Int("offset", 0, "number of sessions to skip")
+	expired := flags.Bool("expired", false, "include expired sessions that haven't been purged")
+	deleted := flags.Bool("deleted", false, "include sessions soft deleted within the grace period")
+	flags.Parse(args)
+
+	infos, err := store.ListSessions(mariadbstore.ListOptions{Limit: *limit, Offset: *offset, IncludeExpired: *expired, IncludeDeleted: *deleted})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	header := "ID\tNAME\tCREATED\tLAST ACTIVE\tEXPIRES\tVALUES"
+	if metadata {
+		header += "\tIP\tUSER AGENT"
+	}
+	if *deleted {
+		header += "\tDELETED"
+	}
+	fmt.Fprintln(w, header)
+	for _, info := range infos {
+		values := "-"
+		if info.Values != nil {
+			values = strconv.Itoa(len(info.Values))
+		}
+		line := strings.Join([]string{info.ID, info.Name, formatTime(info.Created), formatTime(info.LastActive), formatTime(info.Expires), values}, "\t")
+		if metadata {
+			line += "\t" + info.IP + "\t" + info.UserAgent
+		}
+		if *deleted {
+			line += "\t" + formatTime(info.Deleted)
+		}
+		fmt.Fprintln(w, line)
+	}
+	return w.Flush()
+}
+
+func inspect(store *mariadbstore.MariadbStore, id string, metadata bool) error {
+	info, err := store.GetSessionByID(id)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "ID:\t%s\n", info.ID)
+	fmt.Fprintf(w, "Name:\t%s\n", info.Name)
+	fmt.Fprintf(w, "Created:\t%s\n", formatTime(info.Created))
+	fmt.Fprintf(w, "Last active:\t%s\n", formatTime(info.LastActive))
+	fmt.Fprintf(w, "Expires:\t%s\n", formatTime(info.Expires))
+	if metadata {
+		fmt.Fprintf(w, "Updated:\t%s\n", formatTime(info.Updated))
+		fmt.Fprintf(w, "IP:\t%s\n", info.IP)
+		fmt.Fprintf(w, "User agent:\t%s\n", info.UserAgent)
+	}
+	if info.Values == nil {
+		fmt.Fprintln(w, "Values:\tcan't be decoded, check -key, -serializer and -encryption-key")
+		return w.Flush()
+	}
+
+	fmt.Fprintln(w, "Values:")
+	keys := make([]string, 0, len(info.Values))
+	values := make(map[string]interface{}, len(info.Values))
+	for k, v := range info.Values {
+		key := fmt.Sprint(k)
+		keys = append(keys, key)
+		values[key] = v
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %s\t%#v\n", k, values[k])
+	}
+	return w.Flush()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func decodeKey(k string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(k, "hex:"):
+		return hex.DecodeString(strings.TrimPrefix(k, "hex:"))
+	case strings.HasPrefix(k, "base64:"):
+		return base64.StdEncoding.DecodeString(strings.TrimPrefix(k, "base64:"))
+	default:
+		return []byte(k), nil
+	}
+}
+
+func newKeyring(keys []string) (*mariadbstore.Keyring, error) {
+	var primary uint32
+	keyring := make(map[uint32][]byte, len(keys))
+	for i, k := range keys {
+		idText, keyText, ok := strings.Cut(k, ":")
+		if !ok {
+			return nil, fmt.Errorf("%q is not id:hexkey", k)
+		}
+		id, err := strconv.ParseUint(idText, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("key ID %q: %w", idText, err)
+		}
+		key, err := hex.DecodeString(keyText)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", id, err)
+		}
+		if i == 0 {
+			primary = uint32(id)
+		}
+		keyring[uint32(id)] = key
+	}
+	return mariadbstore.NewKeyring(primary, keyring)
+}
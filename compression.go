@@ -0,0 +1,91 @@
+package mariadbstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression selects the algorithm used to compress session data.
+type Compression byte
+
+const (
+	NoCompression Compression = iota
+	Gzip
+	Zstd
+)
+
+// compressedMarker starts every compressed payload and is followed by the
+// Compression byte. None of the bundled serializers produce data starting
+// with a zero byte, so rows written before compression was enabled are still
+// read as they are.
+const compressedMarker = 0x00
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func zstdCodec() (*zstd.Encoder, *zstd.Decoder) {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil)
+		zstdDecoder, _ = zstd.NewReader(nil)
+	})
+	return zstdEncoder, zstdDecoder
+}
+
+// compress compresses data with the store's algorithm when it is at least as
+// long as the threshold.
+func (s *MariadbStore) compress(data []byte) ([]byte, error) {
+	if s.compression == NoCompression || len(data) < s.compressMin {
+		return data, nil
+	}
+
+	out := []byte{compressedMarker, byte(s.compression)}
+	switch s.compression {
+	case Gzip:
+		buf := bytes.NewBuffer(out)
+		zw := gzip.NewWriter(buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		enc, _ := zstdCodec()
+		return enc.EncodeAll(data, out), nil
+	}
+	return nil, fmt.Errorf("unknown compression %d", s.compression)
+}
+
+// decompress reverses compress. Data without the marker is returned as is.
+func decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != compressedMarker {
+		return data, nil
+	}
+	if len(data) < 2 {
+		return nil, errors.New("compressed session data is too short")
+	}
+
+	switch Compression(data[1]) {
+	case Gzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data[2:]))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	case Zstd:
+		_, dec := zstdCodec()
+		return dec.DecodeAll(data[2:], nil)
+	}
+	return nil, fmt.Errorf("unknown compression %d", data[1])
+}
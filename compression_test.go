@@ -0,0 +1,69 @@
+package mariadbstore
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"user":"alice","visits":3}`), 100)
+	for _, c := range []Compression{Gzip, Zstd} {
+		s := &MariadbStore{compression: c, compressMin: 64}
+		compressed, err := s.compress(data)
+		if err != nil {
+			t.Fatalf("compression %d: compress: %v", c, err)
+		}
+		if compressed[0] != compressedMarker || Compression(compressed[1]) != c {
+			t.Errorf("compression %d: data starts with %#x, want the marker and the algorithm", c, compressed[:2])
+		}
+		if len(compressed) >= len(data) {
+			t.Errorf("compression %d: %d bytes compressed to %d", c, len(data), len(compressed))
+		}
+
+		got, err := decompress(compressed)
+		if err != nil {
+			t.Fatalf("compression %d: decompress: %v", c, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("compression %d: decompressed data differs from the original", c)
+		}
+	}
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	s := &MariadbStore{compression: Gzip, compressMin: 64}
+	data := []byte(`{"user":"alice"}`)
+	got, err := s.compress(data)
+	if err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("data below the threshold was compressed to %#x", got)
+	}
+
+	s = &MariadbStore{}
+	long := bytes.Repeat(data, 100)
+	if got, _ := s.compress(long); !bytes.Equal(got, long) {
+		t.Error("data was compressed without compression")
+	}
+}
+
+func TestDecompressMarker(t *testing.T) {
+	// rows written without compression are read as they are
+	for _, data := range [][]byte{nil, []byte(`{"user":"alice"}`), {0x0e, 0xff}} {
+		got, err := decompress(data)
+		if err != nil {
+			t.Errorf("decompress(%#x): %v", data, err)
+			continue
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("decompress(%#x) = %#x, want the data unchanged", data, got)
+		}
+	}
+
+	for _, data := range [][]byte{{compressedMarker}, {compressedMarker, 9, 1}, {compressedMarker, byte(Gzip), 1}} {
+		if _, err := decompress(data); err == nil {
+			t.Errorf("decompress(%#x) succeeded", data)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package mariadbstore
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+type secureKey struct{}
+
+// isTLS reports whether r reached the application over TLS, either directly
+// or through a proxy that sets X-Forwarded-Proto.
+func isTLS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// withSecure records in ctx that cookies set while saving from r must be
+// Secure. Marking a cookie Secure only restricts it, so the forwarded
+// header doesn't need to be trusted.
+func (s *MariadbStore) withSecure(ctx context.Context, r *http.Request) context.Context {
+	if !s.detectTLS || r == nil || !isTLS(r) {
+		return ctx
+	}
+	return context.WithValue(ctx, secureKey{}, true)
+}
+
+// setCookie sets the session cookie to value, adding the Secure attribute
+// for requests detected as TLS.
+func setCookie(ctx context.Context, w http.ResponseWriter, session *sessions.Session, value string) {
+	opts := session.Options
+	if secure, _ := ctx.Value(secureKey{}).(bool); secure && !opts.Secure {
+		o := *opts
+		o.Secure = true
+		opts = &o
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), value, opts))
+}
@@ -0,0 +1,53 @@
+package mariadbstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// DB is the database handle used by the store. *sql.DB implements it, as do
+// wrappers such as *sqlx.DB. Statements must be prepared as *sql.Stmt.
+//
+// GetLocked, WithMaxSessionsPerUser, WithDistributedCleanup and Migrate also
+// need the handle to implement BeginTx or Conn like *sql.DB does.
+type DB interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+type connProvider interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+// isNil reports whether db is nil, including a nil *sql.DB.
+func isNil(db DB) bool {
+	if db == nil {
+		return true
+	}
+	sqlDB, ok := db.(*sql.DB)
+	return ok && sqlDB == nil
+}
+
+func (s *MariadbStore) beginTx(ctx context.Context) (*sql.Tx, error) {
+	b, ok := s.db.(txBeginner)
+	if !ok {
+		return nil, fmt.Errorf("%w: the store's DB doesn't support transactions", errors.ErrUnsupported)
+	}
+	return b.BeginTx(ctx, nil)
+}
+
+func (s *MariadbStore) conn(ctx context.Context) (*sql.Conn, error) {
+	c, ok := s.db.(connProvider)
+	if !ok {
+		return nil, fmt.Errorf("%w: the store's DB doesn't provide dedicated connections", errors.ErrUnsupported)
+	}
+	return c.Conn(ctx)
+}
@@ -0,0 +1,47 @@
+package mariadbstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+func (s *MariadbStore) checkDatabaseCleanup() error {
+	if s.dbCleanup <= 0 {
+		return nil
+	}
+	if s.reportsExpiry() || s.partitionSize > 0 {
+		return errors.New("database cleanup can't be combined with partitioning, OnExpire, the audit log or an expiry handler")
+	}
+	// the server purges the table, so no instance runs the cleanup goroutine
+	s.cleanupInterval = 0
+	return nil
+}
+
+// createCleanupEvent creates or updates the EVENT that purges expired and
+// soft deleted sessions.
+func (s *MariadbStore) createCleanupEvent(ctx context.Context) error {
+	body := `DELETE FROM {table} WHERE {expires} < UNIX_TIMESTAMP(){live}`
+	if s.softDelete > 0 {
+		body = fmt.Sprintf(`BEGIN %s; DELETE FROM {table} WHERE {deleted_at} > 0 AND {deleted_at} < UNIX_TIMESTAMP() - %d; END`, body, int64(s.softDelete.Seconds()))
+	}
+	query := fmt.Sprintf(`CREATE OR REPLACE EVENT {cleanup_event} ON SCHEDULE EVERY %d SECOND DO %s`, int64(s.dbCleanup.Seconds()), body)
+	_, err := s.db.ExecContext(ctx, s.sql(query))
+	return err
+}
+
+// checkEventScheduler fails when the server doesn't run events, so the
+// cleanup event never fires.
+func (s *MariadbStore) checkEventScheduler(ctx context.Context) error {
+	if s.dbCleanup <= 0 {
+		return nil
+	}
+	var state string
+	if err := s.db.QueryRowContext(ctx, `SELECT @@GLOBAL.event_scheduler`).Scan(&state); err != nil {
+		return s.dbError(ctx, "health", "", err)
+	}
+	if state != "ON" {
+		return fmt.Errorf("session cleanup event won't run: event_scheduler is %s", state)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package mariadbstore
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// sessionStore is the sessions.Store attached to sessions created by New. It
+// carries per-session state from New to Save.
+type sessionStore struct {
+	*MariadbStore
+	tracked     bool
+	fingerprint [sha256.Size]byte
+	created     time.Time
+	tx          *sql.Tx
+	// options are the cookie options the row was stored with and expires
+	// is the row's expiry.
+	options storedOptions
+	expires int64
+	// degraded sessions were created while the database was unreachable.
+	degraded bool
+	// rejected is returned by Save for sessions that couldn't be opened, so
+	// they never overwrite the row named in the cookie.
+	rejected error
+	// userID is set with SetUserID and storedUserID is the user the row
+	// was loaded with.
+	userID       string
+	storedUserID string
+}
+
+func stateOf(session *sessions.Session) *sessionStore {
+	st, _ := session.Store().(*sessionStore)
+	return st
+}
+
+// reject makes Save fail with err. The session keeps no ID, so it can't
+// write to the row it was opened for either.
+func reject(session *sessions.Session, err error) {
+	session.ID = ""
+	if st := stateOf(session); st != nil {
+		st.rejected = err
+	}
+}
+
+// rejected returns the error Save fails with for a session passed to reject.
+func rejected(session *sessions.Session) error {
+	if st := stateOf(session); st != nil {
+		return st.rejected
+	}
+	return nil
+}
+
+// fingerprint hashes the session values. fmt prints maps with sorted keys so
+// equal values always produce the same hash.
+func fingerprint(values map[interface{}]interface{}) [sha256.Size]byte {
+	return sha256.Sum256([]byte(fmt.Sprintf("%#v", values)))
+}
+
+// track records the values as they are stored in the database.
+func track(session *sessions.Session) {
+	if st := stateOf(session); st != nil {
+		st.fingerprint = fingerprint(session.Values)
+		st.options = optionsOf(session.Options)
+		st.storedUserID = st.userID
+		st.tracked = true
+	}
+}
+
+// modified reports whether the values, user or cookie options have changed
+// since they were loaded or last saved. Values that are changed through a
+// pointer without touching the map itself aren't detected, so reassign the
+// key after such changes.
+func modified(session *sessions.Session) bool {
+	st := stateOf(session)
+	if st == nil || !st.tracked || st.userID != st.storedUserID || st.options != optionsOf(session.Options) {
+		return true
+	}
+	return st.fingerprint != fingerprint(session.Values)
+}
+
+// setExpires records the expiry a session's row was written with.
+func setExpires(session *sessions.Session, expires int64) {
+	if st := stateOf(session); st != nil {
+		st.expires = expires
+	}
+}
+
+// skipSave reports whether Save can leave an unchanged session alone with
+// WithSkipUnchanged. Its expiry is still extended once less than half of
+// the session's lifetime is left.
+func (s *MariadbStore) skipSave(session *sessions.Session, now time.Time) bool {
+	if !s.skipUnchanged || session.ID == "" || modified(session) {
+		return false
+	}
+	st := stateOf(session)
+	remaining := st.expires - now.Unix()
+	lifetime := s.expiry(session, now) - now.Unix()
+	return remaining > lifetime/2
+}
@@ -0,0 +1,113 @@
+package mariadbstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestFingerprint(t *testing.T) {
+	a := map[interface{}]interface{}{"user": "alice", "visits": 3, 1: []string{"x"}}
+	b := map[interface{}]interface{}{1: []string{"x"}, "visits": 3, "user": "alice"}
+	if fingerprint(a) != fingerprint(b) {
+		t.Error("equal values have different fingerprints")
+	}
+
+	b["visits"] = 4
+	if fingerprint(a) == fingerprint(b) {
+		t.Error("changed values have the same fingerprint")
+	}
+	if fingerprint(map[interface{}]interface{}{"n": 1}) == fingerprint(map[interface{}]interface{}{"n": "1"}) {
+		t.Error("values of different types have the same fingerprint")
+	}
+}
+
+// trackedSession returns a session loaded with a row expiring at expires.
+func trackedSession(s *MariadbStore, expires int64) *sessions.Session {
+	session := s.newSession(&sessionStore{MariadbStore: s}, "session")
+	session.Options.MaxAge = 3600
+	session.ID = "1"
+	session.IsNew = false
+	session.Values["user"] = "alice"
+	track(session)
+	setExpires(session, expires)
+	return session
+}
+
+func TestModified(t *testing.T) {
+	s := testStore(t)
+	session := trackedSession(s, time.Now().Add(time.Hour).Unix())
+	if modified(session) {
+		t.Fatal("loaded session is modified")
+	}
+
+	session.Values["user"] = "bob"
+	if !modified(session) {
+		t.Error("changed value isn't detected")
+	}
+	session.Values["user"] = "alice"
+	if modified(session) {
+		t.Error("value changed back is still modified")
+	}
+
+	session.Options.MaxAge = 86400
+	if !modified(session) {
+		t.Error("changed MaxAge isn't detected")
+	}
+
+	if !modified(sessions.NewSession(s, "untracked")) {
+		t.Error("session without state isn't modified")
+	}
+}
+
+func TestSkipSave(t *testing.T) {
+	now := time.Now()
+	s := testStore(t, WithSkipUnchanged())
+
+	// more than half of the hour is left
+	if session := trackedSession(s, now.Add(45*time.Minute).Unix()); !s.skipSave(session, now) {
+		t.Error("unchanged session with most of its lifetime left is saved")
+	}
+	if session := trackedSession(s, now.Add(20*time.Minute).Unix()); s.skipSave(session, now) {
+		t.Error("unchanged session past half of its lifetime isn't extended")
+	}
+
+	session := trackedSession(s, now.Add(45*time.Minute).Unix())
+	session.Values["visits"] = 1
+	if s.skipSave(session, now) {
+		t.Error("modified session isn't saved")
+	}
+
+	session = trackedSession(s, now.Add(45*time.Minute).Unix())
+	session.ID = ""
+	if s.skipSave(session, now) {
+		t.Error("session without a row isn't saved")
+	}
+
+	s = testStore(t)
+	if s.skipSave(trackedSession(s, now.Add(45*time.Minute).Unix()), now) {
+		t.Error("unchanged session is skipped without WithSkipUnchanged")
+	}
+}
+
+func TestGetKeepsState(t *testing.T) {
+	s, db := newFakeStore(t)
+	serveRow(t, s, db, map[interface{}]interface{}{"user": "alice"}, time.Now().Add(time.Hour))
+	r := requestWithSession(t, s, "session", "5")
+
+	session, err := s.Get(r, "session")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if stateOf(session) == nil || modified(session) {
+		t.Fatal("session returned by Get lost the state it was loaded with")
+	}
+	again, err := s.Get(r, "session")
+	if err != nil || again != session {
+		t.Fatalf("second Get = %p, %v, want the same session", again, err)
+	}
+	if stateOf(again) == nil || modified(again) {
+		t.Error("second Get lost the session's state")
+	}
+}
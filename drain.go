@@ -0,0 +1,78 @@
+package mariadbstore
+
+import (
+	"context"
+	"sync"
+)
+
+// drainer tracks the saves in flight so Drain can wait for them.
+type drainer struct {
+	mu       sync.Mutex
+	draining bool
+	writes   sync.WaitGroup
+	// sweeping is held while the background cleanup runs.
+	sweeping sync.Mutex
+}
+
+// beginWrite registers a save. It fails once the store is draining.
+func (d *drainer) beginWrite() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return ErrStoreDraining
+	}
+	d.writes.Add(1)
+	return nil
+}
+
+func (d *drainer) endWrite() {
+	d.writes.Done()
+}
+
+func (d *drainer) isDraining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// Drain prepares the store for shutdown during a rolling deploy. Saves,
+// deletes, imports and re-encodes return ErrStoreDraining from then on, New
+// no longer inserts rows for new sessions, and sessions can still be loaded.
+// Drain waits for the writes and the background cleanup in progress, which
+// isn't run again, then writes the refreshes held back by WithWriteBehind.
+// CleanExpired and Migrate still run when they are called directly.
+// It returns once everything is written, or ctx.Err() if ctx is done first.
+// Call it after the HTTP server has stopped accepting requests, and Close
+// the store afterwards.
+func (s *MariadbStore) Drain(ctx context.Context) error {
+	if err := s.checkOpen(); err != nil {
+		return err
+	}
+	s.drain.mu.Lock()
+	s.drain.draining = true
+	s.drain.mu.Unlock()
+
+	var err error
+	s.eachTenant(func(t *MariadbStore) {
+		if err == nil {
+			err = t.Drain(ctx)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.drain.writes.Wait()
+		s.drain.sweeping.Lock()
+		s.drain.sweeping.Unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.Flush(ctx)
+}
@@ -0,0 +1,91 @@
+package mariadbstore
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	s, db := newFakeStore(t)
+	if err := s.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	// the cookie names a session without a row, which would be inserted
+	session, err := s.New(requestWithSession(t, s, "session", "5"), "session")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if queries, _ := db.ran("INSERT"); len(queries) != 0 {
+		t.Errorf("New inserted while draining: %q", queries)
+	}
+	if session.ID != "" {
+		t.Errorf("new session has the ID %q without a row", session.ID)
+	}
+
+	session.Values["user"] = "alice"
+	if err := s.Save(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder(), session); !errors.Is(err, ErrStoreDraining) {
+		t.Errorf("Save = %v, want ErrStoreDraining", err)
+	}
+	if err := s.DeleteSessionByID("5"); !errors.Is(err, ErrStoreDraining) {
+		t.Errorf("DeleteSessionByID = %v, want ErrStoreDraining", err)
+	}
+	if err := s.Import(context.Background(), strings.NewReader("")); !errors.Is(err, ErrStoreDraining) {
+		t.Errorf("Import = %v, want ErrStoreDraining", err)
+	}
+	if queries, _ := db.ran("INSERT"); len(queries) != 0 {
+		t.Errorf("rows were written while draining: %q", queries)
+	}
+}
+
+func TestDrainWaitsForWrites(t *testing.T) {
+	s, db := newFakeStore(t)
+	writing := make(chan struct{})
+	release := make(chan struct{})
+	db.setHandler(func(query string, args []driver.Value) (fakeResult, error) {
+		if strings.HasPrefix(query, "INSERT") {
+			close(writing)
+			<-release
+		}
+		return fakeResult{rowsAffected: 1}, nil
+	})
+
+	saved := make(chan error, 1)
+	go func() {
+		session, err := s.New(httptest.NewRequest(http.MethodGet, "/", nil), "session")
+		if err == nil {
+			session.Values["user"] = "alice"
+			err = s.Save(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder(), session)
+		}
+		saved <- err
+	}()
+	<-writing
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Drain with a save in flight = %v, want the deadline", err)
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- s.Drain(context.Background()) }()
+	select {
+	case err := <-drained:
+		t.Fatalf("Drain returned %v before the save finished", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-saved; err != nil {
+		t.Errorf("save in flight: %v", err)
+	}
+	if err := <-drained; err != nil {
+		t.Errorf("Drain: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package mariadbstore
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// DefaultTableName is the table used by NewMariadbStoreDSN.
+const DefaultTableName = "sessions"
+
+// NewMariadbStoreDSN opens a connection pool for dsn and creates a store in
+// the DSN's database, using the sessions table. The store owns the pool and
+// closes it in Close. The database named in the DSN is created if it
+// doesn't exist.
+func NewMariadbStoreDSN(dsn string, opts ...Option) (*MariadbStore, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	databaseName := cfg.DBName
+	if databaseName == "" {
+		return nil, errors.New("dsn must name a database")
+	}
+
+	// the store qualifies every table with the database name, so the pool
+	// doesn't select one and can connect before the database exists
+	cfg.DBName = ""
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(25)
+	db.SetConnMaxLifetime(5 * time.Minute)
+	db.SetConnMaxIdleTime(time.Minute)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s, err := NewMariadbStoreWithOptions(db, databaseName, DefaultTableName, append(opts, ownDB(db))...)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// ownDB makes Close close the store's connection pool.
+func ownDB(db *sql.DB) Option {
+	return func(s *MariadbStore) error {
+		s.ownedDB = db
+		return nil
+	}
+}
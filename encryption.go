@@ -0,0 +1,90 @@
+package mariadbstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const keyIDSize = 4
+
+// encryptedMarker starts encrypted session data, so rows written before
+// encryption was enabled are still read as they are.
+const encryptedMarker = 0x01
+
+// Keyring holds the AES-GCM keys used to encrypt session data at rest. Data is
+// always encrypted with the primary key; the other keys are only used to
+// decrypt rows written before a rotation.
+type Keyring struct {
+	primary uint32
+	aeads   map[uint32]cipher.AEAD
+}
+
+// NewKeyring creates a keyring from AES keys indexed by key ID. Keys must be
+// 16, 24 or 32 bytes long and primaryID must be one of the IDs in keys.
+func NewKeyring(primaryID uint32, keys map[uint32][]byte) (*Keyring, error) {
+	if _, ok := keys[primaryID]; !ok {
+		return nil, fmt.Errorf("primary key %d is not in the keyring", primaryID)
+	}
+
+	k := &Keyring{
+		primary: primaryID,
+		aeads:   make(map[uint32]cipher.AEAD, len(keys)),
+	}
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %v", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %v", id, err)
+		}
+		k.aeads[id] = aead
+	}
+	return k, nil
+}
+
+// encrypt seals data with the primary key. The result is the marker followed
+// by the key ID, the nonce and the ciphertext.
+func (k *Keyring) encrypt(data []byte) ([]byte, error) {
+	aead := k.aeads[k.primary]
+
+	header := 1 + keyIDSize + aead.NonceSize()
+	out := make([]byte, header, header+len(data)+aead.Overhead())
+	out[0] = encryptedMarker
+	binary.BigEndian.PutUint32(out[1:], k.primary)
+	nonce := out[1+keyIDSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, data, out[1:1+keyIDSize]), nil
+}
+
+// decrypt reverses encrypt. Data without the marker was written before
+// encryption was enabled and is returned as is.
+func (k *Keyring) decrypt(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != encryptedMarker {
+		return data, nil
+	}
+
+	data = data[1:]
+	if len(data) < keyIDSize {
+		return nil, errors.New("encrypted session data is too short")
+	}
+
+	id := binary.BigEndian.Uint32(data)
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %d", id)
+	}
+
+	if len(data) < keyIDSize+aead.NonceSize() {
+		return nil, errors.New("encrypted session data is too short")
+	}
+	nonce := data[keyIDSize : keyIDSize+aead.NonceSize()]
+	return aead.Open(nil, nonce, data[keyIDSize+aead.NonceSize():], data[:keyIDSize])
+}
@@ -0,0 +1,132 @@
+package mariadbstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+var (
+	testKey1 = bytes.Repeat([]byte{1}, 32)
+	testKey2 = bytes.Repeat([]byte{2}, 32)
+)
+
+func newTestKeyring(t *testing.T, primary uint32, keys map[uint32][]byte) *Keyring {
+	t.Helper()
+	k, err := NewKeyring(primary, keys)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return k
+}
+
+func TestKeyringRotation(t *testing.T) {
+	plain := []byte("session values")
+	old := newTestKeyring(t, 1, map[uint32][]byte{1: testKey1})
+	sealed, err := old.encrypt(plain)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	rotated := newTestKeyring(t, 2, map[uint32][]byte{1: testKey1, 2: testKey2})
+	got, err := rotated.decrypt(sealed)
+	if err != nil {
+		t.Fatalf("decrypting a row of the old key after the rotation: %v", err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("decrypted %q, want %q", got, plain)
+	}
+
+	resealed, err := rotated.encrypt(plain)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if resealed[0] != encryptedMarker {
+		t.Fatalf("encrypted data starts with %#x, want the marker", resealed[0])
+	}
+	if id := binary.BigEndian.Uint32(resealed[1:]); id != 2 {
+		t.Errorf("data is encrypted with key %d, want the primary key 2", id)
+	}
+
+	retired := newTestKeyring(t, 2, map[uint32][]byte{2: testKey2})
+	if _, err := retired.decrypt(sealed); err == nil {
+		t.Error("data of a key removed from the keyring was decrypted")
+	}
+}
+
+func TestKeyringPlaintext(t *testing.T) {
+	k := newTestKeyring(t, 1, map[uint32][]byte{1: testKey1})
+	for _, plain := range [][]byte{nil, []byte(`{"user":"alice"}`), {0x00, 0xff}} {
+		got, err := k.decrypt(plain)
+		if err != nil {
+			t.Errorf("decrypt(%q): %v", plain, err)
+			continue
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("decrypt(%q) = %q, want the data unchanged", plain, got)
+		}
+	}
+}
+
+func TestKeyringTampered(t *testing.T) {
+	k := newTestKeyring(t, 1, map[uint32][]byte{1: testKey1})
+	sealed, err := k.encrypt([]byte("values"))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	sealed[len(sealed)-1] ^= 0xff
+	if _, err := k.decrypt(sealed); err == nil {
+		t.Error("tampered data was decrypted")
+	}
+	if _, err := k.decrypt([]byte{encryptedMarker, 0}); err == nil {
+		t.Error("truncated data was decrypted")
+	}
+}
+
+func TestNewKeyring(t *testing.T) {
+	if _, err := NewKeyring(3, map[uint32][]byte{1: testKey1}); err == nil {
+		t.Error("keyring without its primary key was created")
+	}
+	if _, err := NewKeyring(1, map[uint32][]byte{1: []byte("short")}); err == nil {
+		t.Error("keyring with an invalid AES key was created")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	s := &MariadbStore{
+		serializer: JSONSerializer{},
+		keyring:    newTestKeyring(t, 1, map[uint32][]byte{1: testKey1}),
+	}
+	session := sessions.NewSession(nil, "session")
+	session.Values["user"] = "alice"
+	encoded, err := s.encode(session)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if bytes.Contains(encoded, []byte("alice")) {
+		t.Error("encoded data holds the plaintext values")
+	}
+
+	got := sessions.NewSession(nil, "session")
+	if err := s.decode(encoded, got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Values["user"] != "alice" {
+		t.Errorf("decoded values %v", got.Values)
+	}
+
+	// rows written before encryption was enabled are still read
+	plainStore := &MariadbStore{serializer: JSONSerializer{}}
+	plain, err := plainStore.encode(session)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if err := s.decode(plain, sessions.NewSession(nil, "session")); err != nil {
+		t.Errorf("decoding a plaintext row with a keyring: %v", err)
+	}
+	if err := plainStore.decode(encoded, sessions.NewSession(nil, "session")); err == nil {
+		t.Error("encrypted data was read by a store without a keyring")
+	}
+}
@@ -0,0 +1,49 @@
+package mariadbstore
+
+import "errors"
+
+var (
+	// ErrSessionNotFound is returned when a session doesn't exist in the
+	// database.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionExpired is returned when a stored session has expired.
+	ErrSessionExpired = errors.New("session expired")
+	// ErrDecodeFailed is returned when a session cookie or stored session
+	// can't be decoded, e.g. after the keys changed or the data was
+	// tampered with.
+	ErrDecodeFailed = errors.New("session decode failed")
+	// ErrStoreUnavailable wraps errors returned by the database.
+	ErrStoreUnavailable = errors.New("session store unavailable")
+	// ErrSessionTooLarge is returned by Save when the serialized session
+	// values exceed the limit set with WithMaxDataSize.
+	ErrSessionTooLarge = errors.New("session too large")
+	// ErrSessionHijackSuspected is returned by New when a session bound with
+	// WithSessionBinding is presented by a different client. New replaces it
+	// with a new session.
+	ErrSessionHijackSuspected = errors.New("session hijack suspected")
+	// ErrBadCookie is returned by New, with WithBadCookiePolicy, when the
+	// session cookie or the session it names can't be decoded. It wraps
+	// ErrDecodeFailed. New replaces the session with a new one.
+	ErrBadCookie = errors.New("bad session cookie")
+	// ErrTooManySessions is returned by Save when associating a session with
+	// a user would exceed the limit set with WithMaxSessionsPerUser.
+	ErrTooManySessions = errors.New("too many sessions for user")
+	// ErrSessionVanished is returned by Save when the session's row was
+	// deleted after the session was loaded, e.g. by a logout, a revocation
+	// or the cleanup. Nothing is written, so the deletion stands, and the
+	// client gets a new session on its next request.
+	ErrSessionVanished = errors.New("session vanished before save")
+	// ErrStoreDraining is returned by Save, SaveTx, DeleteSessionByID,
+	// Import and Reencode after Drain was called.
+	ErrStoreDraining = errors.New("session store draining")
+	// ErrSessionExists is returned by Import when a record has the ID of a
+	// stored session, unless ReplaceExisting or SkipExisting is used.
+	ErrSessionExists = errors.New("session already exists")
+	// ErrTenantUnavailable is returned by New, NewTx and GetLocked with
+	// WithTenantFunc when the store of the request's tenant can't be
+	// created, e.g. for an invalid tenant or once the WithMaxTenants limit
+	// is reached. Save refuses the session New returns with it.
+	ErrTenantUnavailable = errors.New("session tenant unavailable")
+	// ErrStoreClosed is returned by store methods called after Close.
+	ErrStoreClosed = errors.New("session store closed")
+)
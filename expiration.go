@@ -0,0 +1,53 @@
+package mariadbstore
+
+import (
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// ExpirationPolicy controls how long a stored session stays valid.
+type ExpirationPolicy struct {
+	// IdleTimeout expires a session that hasn't been saved for the given
+	// duration. Every save slides the expiry forward. Zero uses the
+	// session's MaxAge, or the browser session TTL when MaxAge is zero.
+	IdleTimeout time.Duration
+	// AbsoluteTimeout caps the lifetime of a session from the time it was
+	// created, no matter how active it is. Zero means no cap.
+	AbsoluteTimeout time.Duration
+}
+
+// expiry returns the expires column value for a session saved at now.
+func (s *MariadbStore) expiry(session *sessions.Session, now time.Time) int64 {
+	expires := now.Add(time.Second * time.Duration(session.Options.MaxAge))
+	if session.Options.MaxAge == 0 {
+		// the cookie lasts until the browser closes, which the server can't
+		// see, so the row is kept for a fixed time instead
+		expires = now.Add(s.browserTTL)
+	}
+	if s.expiration.IdleTimeout > 0 {
+		expires = now.Add(s.expiration.IdleTimeout)
+	}
+
+	if s.expiration.AbsoluteTimeout > 0 {
+		if st := stateOf(session); st != nil && !st.created.IsZero() {
+			if limit := st.created.Add(s.expiration.AbsoluteTimeout); limit.Before(expires) {
+				expires = limit
+			}
+		}
+	}
+	return expires.Unix()
+}
+
+// expired reports whether a session created and last active at the given
+// unix times has outlived the policy. Rows written before the columns existed
+// have zero times and are only checked against what is known.
+func (p ExpirationPolicy) expired(created, lastActive int64, now time.Time) bool {
+	if p.IdleTimeout > 0 && lastActive > 0 && now.After(time.Unix(lastActive, 0).Add(p.IdleTimeout)) {
+		return true
+	}
+	if p.AbsoluteTimeout > 0 && created > 0 && now.After(time.Unix(created, 0).Add(p.AbsoluteTimeout)) {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package mariadbstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SessionRecord is a session as written by Export and read by Import.
+type SessionRecord struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Created    time.Time `json:"created"`
+	LastActive time.Time `json:"last_active"`
+	Expires    time.Time `json:"expires"`
+	// UserID is only exported and imported with WithMaxSessionsPerUser.
+	UserID string `json:"user_id,omitempty"`
+	// Data holds the session values as written by the store's serializer,
+	// before compression and encryption.
+	Data []byte `json:"data"`
+}
+
+// Export writes every session that hasn't expired to w as JSON lines, one
+// SessionRecord per line, ordered by ID. The records hold everything needed
+// to use the sessions, so an export must be protected like the session
+// cookies themselves.
+func (s *MariadbStore) Export(ctx context.Context, w io.Writer) error {
+	if err := s.checkOpen(); err != nil {
+		return err
+	}
+
+	columns := "{id}, {name}, {created_at}, {last_active}, {expires}, {session_data}"
+	if s.maxPerUser > 0 {
+		columns += ", {user_id}"
+	}
+	rows, err := s.db.QueryContext(ctx, s.sql(`SELECT `+columns+` FROM {table} WHERE {expires} > ?{live} ORDER BY {id}`), time.Now().Unix())
+	if err != nil {
+		return s.dbError(ctx, "export", "", err)
+	}
+	defer rows.Close()
+
+	enc := json.NewEncoder(w)
+	for rows.Next() {
+		var rec SessionRecord
+		var created, lastActive, expires int64
+		var data []byte
+		dest := []any{&rec.ID, &rec.Name, &created, &lastActive, &expires, &data}
+		if s.maxPerUser > 0 {
+			dest = append(dest, &rec.UserID)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		if rec.Data, err = s.unseal(data); err != nil {
+			return fmt.Errorf("session %s: %w", rec.ID, err)
+		}
+		if created > 0 {
+			rec.Created = time.Unix(created, 0)
+		}
+		if lastActive > 0 {
+			rec.LastActive = time.Unix(lastActive, 0)
+		}
+		rec.Expires = time.Unix(expires, 0)
+
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ImportOption configures Import.
+type ImportOption func(*importOptions)
+
+type importOptions struct {
+	skip    bool
+	replace bool
+}
+
+// SkipExisting makes Import keep the stored sessions whose IDs are in the
+// records and go on with the next record.
+func SkipExisting() ImportOption {
+	return func(o *importOptions) {
+		o.skip = true
+		o.replace = false
+	}
+}
+
+// ReplaceExisting makes Import overwrite the stored sessions whose IDs are in
+// the records.
+func ReplaceExisting() ImportOption {
+	return func(o *importOptions) {
+		o.replace = true
+		o.skip = false
+	}
+}
+
+// Import stores the sessions read from r, written as JSON lines of
+// SessionRecord by Export or by a tool converting another store's sessions.
+// Sessions keep their IDs, so their cookies stay valid as long as the store
+// uses the same key pairs. A record with the ID of a stored session that
+// hasn't expired fails with ErrSessionExists, leaving the records before it
+// imported, unless SkipExisting or ReplaceExisting is given. Records that
+// have already expired are skipped.
+func (s *MariadbStore) Import(ctx context.Context, r io.Reader, opts ...ImportOption) error {
+	if err := s.checkOpen(); err != nil {
+		return err
+	}
+	var o importOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := s.drain.beginWrite(); err != nil {
+		return err
+	}
+	defer s.drain.endWrite()
+
+	set := "{name}=?, {created_at}=?, {last_active}=?, {expires}=?, {session_data}=?"
+	if s.maxPerUser > 0 {
+		set += ", {user_id}=?"
+	}
+	if s.softDelete > 0 {
+		set += ", {deleted_at}=0"
+	}
+	stmt, err := s.db.PrepareContext(ctx, s.sql(`INSERT INTO {table} SET {id}=?, `+set+` ON DUPLICATE KEY UPDATE `+set))
+	if err != nil {
+		return s.dbError(ctx, "import", "", err)
+	}
+	defer stmt.Close()
+
+	var exists *sql.Stmt
+	if !o.replace {
+		exists, err = s.db.PrepareContext(ctx, s.sql(`SELECT 1 FROM {table} WHERE {id}=? AND {expires} > ?`))
+		if err != nil {
+			return s.dbError(ctx, "import", "", err)
+		}
+		defer exists.Close()
+	}
+
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var rec SessionRecord
+		if err := dec.Decode(&rec); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("record %d: %w", line, err)
+		}
+		if rec.ID == "" {
+			return fmt.Errorf("record %d: missing session ID", line)
+		}
+
+		now := time.Now()
+		if !rec.Expires.After(now) {
+			continue
+		}
+		if exists != nil {
+			var one int
+			err := exists.QueryRowContext(ctx, rec.ID, now.Unix()).Scan(&one)
+			switch {
+			case err == nil && o.skip:
+				continue
+			case err == nil:
+				return fmt.Errorf("record %d: session %s: %w", line, rec.ID, ErrSessionExists)
+			case !errors.Is(err, sql.ErrNoRows):
+				return s.dbError(ctx, "import", rec.ID, err)
+			}
+		}
+
+		data, err := s.seal(rec.Data)
+		if err != nil {
+			return fmt.Errorf("record %d: %w", line, err)
+		}
+		values := []any{rec.Name, unixOrZero(rec.Created), unixOrZero(rec.LastActive), rec.Expires.Unix(), data}
+		if s.maxPerUser > 0 {
+			values = append(values, rec.UserID)
+		}
+		args := append(append([]any{rec.ID}, values...), values...)
+
+		s.cache.remove(rec.ID)
+		// the primary key of a partitioned table includes the expiry, so an
+		// existing row wouldn't be replaced
+		if s.partitionSize > 0 {
+			if _, err := s.exec(ctx, s.deleteStmt, rec.ID); err != nil {
+				return s.dbError(ctx, "import", rec.ID, err)
+			}
+		}
+		if _, err := s.exec(ctx, stmt, args...); err != nil {
+			return s.dbError(ctx, "import", rec.ID, err)
+		}
+	}
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,126 @@
+package mariadbstore
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// importRecords returns the records as Export writes them.
+func importRecords(t *testing.T, recs ...SessionRecord) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, rec := range recs {
+		if err := enc.Encode(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &buf
+}
+
+// storedIDs makes db report the sessions with the given IDs as stored.
+func storedIDs(db *fakeDB, ids ...string) {
+	db.setHandler(func(query string, args []driver.Value) (fakeResult, error) {
+		if strings.HasPrefix(query, "SELECT 1 ") && slices.Contains(ids, args[0].(string)) {
+			return fakeResult{columns: []string{"1"}, rows: [][]driver.Value{{int64(1)}}}, nil
+		}
+		return fakeResult{rowsAffected: 1}, nil
+	})
+}
+
+// imported returns the IDs of the sessions written by Import.
+func imported(db *fakeDB) []string {
+	var ids []string
+	_, args := db.ran("INSERT INTO")
+	for _, a := range args {
+		ids = append(ids, a[0].(string))
+	}
+	return ids
+}
+
+func TestImport(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+	records := []SessionRecord{
+		{ID: "a", Name: "session", Expires: expires, Data: []byte(`{}`)},
+		{ID: "b", Name: "session", Expires: expires, Data: []byte(`{}`)},
+		{ID: "c", Name: "session", Expires: time.Now().Add(-time.Hour), Data: []byte(`{}`)},
+	}
+
+	tests := []struct {
+		name string
+		opts []ImportOption
+		err  error
+		want []string
+	}{
+		{"default", nil, ErrSessionExists, []string{"a"}},
+		{"skip", []ImportOption{SkipExisting()}, nil, []string{"a"}},
+		{"replace", []ImportOption{ReplaceExisting()}, nil, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newFakeStore(t)
+			storedIDs(db, "b")
+			err := s.Import(context.Background(), importRecords(t, records...), tt.opts...)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Import = %v, want %v", err, tt.err)
+			}
+			if got := imported(db); !slices.Equal(got, tt.want) {
+				t.Errorf("imported %q, want %q", got, tt.want)
+			}
+			if queries, _ := db.ran("SELECT 1 "); tt.name == "replace" && len(queries) > 0 {
+				t.Errorf("ReplaceExisting looked up the stored sessions: %q", queries)
+			}
+		})
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	src, srcDB := newFakeStore(t)
+	data, err := src.seal([]byte(`{"user":"alice"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Now().Add(-time.Hour).Unix()
+	expires := time.Now().Add(time.Hour).Unix()
+	srcDB.setHandler(func(query string, args []driver.Value) (fakeResult, error) {
+		return fakeResult{
+			columns: []string{"id", "name", "created_at", "last_active", "expires", "session_data"},
+			rows:    [][]driver.Value{{"a", "session", created, int64(0), expires, data}},
+		}, nil
+	})
+	var buf bytes.Buffer
+	if err := src.Export(context.Background(), &buf); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	var rec SessionRecord
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("exported %q: %v", buf.String(), err)
+	}
+	if rec.ID != "a" || string(rec.Data) != `{"user":"alice"}` || rec.Created.Unix() != created || !rec.LastActive.IsZero() || rec.Expires.Unix() != expires {
+		t.Errorf("exported %+v", rec)
+	}
+
+	dst, dstDB := newFakeStore(t)
+	if err := dst.Import(context.Background(), &buf); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	_, args := dstDB.ran("INSERT INTO")
+	if len(args) != 1 {
+		t.Fatalf("imported %d sessions, want 1", len(args))
+	}
+	stored, err := dst.unseal(args[0][5].([]byte))
+	if err != nil || string(stored) != `{"user":"alice"}` {
+		t.Errorf("imported data %q, %v", stored, err)
+	}
+	if args[0][3] != int64(0) || args[0][4] != expires {
+		t.Errorf("imported last_active and expires %v, %v", args[0][3], args[0][4])
+	}
+}
@@ -0,0 +1,165 @@
+package mariadbstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// FailurePolicy decides how New and Save behave while the database is
+// unreachable.
+type FailurePolicy int
+
+const (
+	// FailClosed returns ErrStoreUnavailable, so requests fail. Save
+	// returns the same error for the session New returned with it, so the
+	// stored session isn't overwritten. This is the default.
+	FailClosed FailurePolicy = iota
+	// FailOpen gives requests a new empty session and doesn't store it.
+	// The client keeps its cookie, so it gets its session back once the
+	// database recovers.
+	FailOpen
+	// FailToCookie gives requests a new session and stores it in a signed
+	// cookie, like WithHybridStorage, until the database recovers. The
+	// first save after that moves it back into the database, replacing
+	// the session the client had before the outage.
+	FailToCookie
+)
+
+// maxCookieSize is the largest cookie browsers are required to accept.
+const maxCookieSize = 4096
+
+// breaker stops the store from querying an unreachable database on every
+// request. After threshold consecutive failures it opens for cooldown. Then
+// it's half-open: a single request probes the database while the others are
+// still refused, and the breaker closes on its success or opens again.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow reports whether a database operation may run, and whether it's the
+// probe of a half-open breaker, which must be passed on to record.
+func (b *breaker) allow(now time.Time) (ok, probe bool) {
+	if b == nil {
+		return true, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true, false
+	}
+	if now.Before(b.openUntil) || b.probing {
+		return false, false
+	}
+	b.probing = true
+	return true, true
+}
+
+// isOpen reports whether allow refuses operations, without claiming the
+// probe.
+func (b *breaker) isOpen(now time.Time) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= b.threshold && (now.Before(b.openUntil) || b.probing)
+}
+
+// record counts a database failure or resets the count on success. It
+// reports whether the breaker opened.
+func (b *breaker) record(err error, now time.Time, probe bool) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if !errors.Is(err, ErrStoreUnavailable) {
+		b.failures = 0
+		return false
+	}
+	b.failures++
+	if b.failures < b.threshold {
+		return false
+	}
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
+
+var errBreakerOpen = fmt.Errorf("%w: circuit breaker open", ErrStoreUnavailable)
+
+// guard runs a database operation through the circuit breaker.
+func (s *MariadbStore) guard(ctx context.Context, op func() error) error {
+	now := time.Now()
+	ok, probe := s.breaker.allow(now)
+	if !ok {
+		return errBreakerOpen
+	}
+	err := op()
+	if s.breaker.record(err, now, probe) {
+		s.log(ctx, s.logLevels.DB, "session store circuit breaker opened", "cooldown", s.breaker.cooldown, "error", err)
+	}
+	return err
+}
+
+// degradeOpen replaces a session that couldn't be loaded because the
+// database is unreachable, unless the store fails closed.
+func (s *MariadbStore) degradeOpen(ctx context.Context, session *sessions.Session, err error) error {
+	if s.failurePolicy == FailClosed || !errors.Is(err, ErrStoreUnavailable) {
+		return err
+	}
+	s.log(ctx, s.logLevels.DB, "session store unavailable, using a degraded session", "error", err)
+	session.ID = ""
+	session.IsNew = true
+	session.Values = make(map[interface{}]interface{})
+	if st := stateOf(session); st != nil {
+		st.degraded = true
+		st.rejected = nil
+	}
+	return nil
+}
+
+// degraded reports whether Save must bypass the database.
+func (s *MariadbStore) degraded(session *sessions.Session) bool {
+	if s.failurePolicy == FailClosed {
+		return false
+	}
+	st := stateOf(session)
+	return st != nil && st.degraded || s.breaker.isOpen(time.Now())
+}
+
+// writeDegraded saves a session without the database according to the
+// failure policy. It returns cause if the session can't be kept that way.
+func (s *MariadbStore) writeDegraded(ctx context.Context, w http.ResponseWriter, session *sessions.Session, cause error) error {
+	if session.Options.MaxAge < 0 {
+		setCookie(ctx, w, session, "")
+		return nil
+	}
+	if s.failurePolicy == FailOpen {
+		return nil
+	}
+
+	value, err := s.cookieValue(session)
+	if err != nil {
+		return err
+	}
+	if len(value) > maxCookieSize {
+		return cause
+	}
+	setCookie(ctx, w, session, value)
+	return nil
+}
@@ -0,0 +1,91 @@
+package mariadbstore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var errTestUnavailable = fmt.Errorf("%w: connection refused", ErrStoreUnavailable)
+
+func TestBreakerOpens(t *testing.T) {
+	b := &breaker{threshold: 2, cooldown: time.Minute}
+	now := time.Now()
+
+	if ok, probe := b.allow(now); !ok || probe {
+		t.Fatalf("closed breaker: allow = %v, %v, want true, false", ok, probe)
+	}
+	if b.record(errTestUnavailable, now, false) {
+		t.Error("breaker opened before the threshold")
+	}
+	// other errors don't count
+	if b.record(errors.New("duplicate key"), now, false) {
+		t.Error("breaker opened on an error that isn't ErrStoreUnavailable")
+	}
+	b.record(errTestUnavailable, now, false)
+	if !b.record(errTestUnavailable, now, false) {
+		t.Fatal("breaker didn't open at the threshold")
+	}
+
+	if ok, _ := b.allow(now.Add(30 * time.Second)); ok {
+		t.Error("open breaker allowed an operation during the cooldown")
+	}
+	if !b.isOpen(now.Add(30 * time.Second)) {
+		t.Error("breaker isn't open during the cooldown")
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b := &breaker{threshold: 1, cooldown: time.Minute}
+	now := time.Now()
+	b.record(errTestUnavailable, now, false)
+
+	later := now.Add(2 * time.Minute)
+	if b.isOpen(later) {
+		t.Error("breaker is open after the cooldown")
+	}
+	ok, probe := b.allow(later)
+	if !ok || !probe {
+		t.Fatalf("half-open breaker: allow = %v, %v, want the probe", ok, probe)
+	}
+	for range 3 {
+		if ok, _ := b.allow(later); ok {
+			t.Fatal("half-open breaker allowed a second operation while probing")
+		}
+	}
+	if !b.isOpen(later) {
+		t.Error("breaker isn't open while probing")
+	}
+
+	// a failed probe opens the breaker for another cooldown
+	if !b.record(errTestUnavailable, later, true) {
+		t.Error("failed probe didn't open the breaker")
+	}
+	if ok, _ := b.allow(later.Add(30 * time.Second)); ok {
+		t.Error("breaker allowed an operation after a failed probe")
+	}
+
+	latest := later.Add(2 * time.Minute)
+	if ok, probe := b.allow(latest); !ok || !probe {
+		t.Fatalf("allow = %v, %v, want the next probe", ok, probe)
+	}
+	if b.record(nil, latest, true) {
+		t.Error("successful probe opened the breaker")
+	}
+	for range 3 {
+		if ok, probe := b.allow(latest); !ok || probe {
+			t.Fatalf("closed breaker: allow = %v, %v, want true, false", ok, probe)
+		}
+	}
+}
+
+func TestNilBreaker(t *testing.T) {
+	var b *breaker
+	if ok, probe := b.allow(time.Now()); !ok || probe {
+		t.Errorf("nil breaker: allow = %v, %v, want true, false", ok, probe)
+	}
+	if b.isOpen(time.Now()) || b.record(errTestUnavailable, time.Now(), false) {
+		t.Error("nil breaker opened")
+	}
+}
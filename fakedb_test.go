@@ -0,0 +1,210 @@
+package mariadbstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// fakeResult is what a fakeDB statement returns.
+type fakeResult struct {
+	columns      []string
+	rows         [][]driver.Value
+	lastInsertID int64
+	rowsAffected int64
+}
+
+// fakeDB is a database/sql driver for unit tests. Every statement is passed
+// to handle, and statements without a handler succeed without rows.
+type fakeDB struct {
+	mu      sync.Mutex
+	handle  func(query string, args []driver.Value) (fakeResult, error)
+	queries []string
+	args    [][]driver.Value
+	// statements prepared up to stale are rejected like the server does
+	// after the table was altered
+	prepared int
+	stale    int
+}
+
+// newFakeStore opens a store on a fakeDB. The store is closed when the test
+// ends.
+func newFakeStore(t *testing.T, opts ...Option) (*MariadbStore, *fakeDB) {
+	t.Helper()
+	f := &fakeDB{}
+	db := sql.OpenDB(fakeConnector{f})
+	t.Cleanup(func() { db.Close() })
+
+	opts = append([]Option{WithKeyPairs([]byte("secret")), WithoutCleanup()}, opts...)
+	s, err := NewMariadbStoreWithOptions(db, "sessions", "sessions", opts...)
+	if err != nil {
+		t.Fatalf("NewMariadbStoreWithOptions: %v", err)
+	}
+	t.Cleanup(s.Close)
+	return s, f
+}
+
+// setHandler replaces the handler of the statements run from now on.
+func (f *fakeDB) setHandler(handle func(query string, args []driver.Value) (fakeResult, error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handle = handle
+}
+
+// invalidate makes the statements prepared so far fail with error 1615.
+func (f *fakeDB) invalidate() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stale = f.prepared
+}
+
+func (f *fakeDB) run(seq int, query string, args []driver.Value) (fakeResult, error) {
+	f.mu.Lock()
+	if seq <= f.stale {
+		f.mu.Unlock()
+		return fakeResult{}, &mysql.MySQLError{Number: errNeedReprepare, Message: "Prepared statement needs to be re-prepared"}
+	}
+	f.queries = append(f.queries, query)
+	f.args = append(f.args, args)
+	handle := f.handle
+	f.mu.Unlock()
+	if handle == nil {
+		return fakeResult{}, nil
+	}
+	return handle(query, args)
+}
+
+// ran returns the statements run so far that contain substr, and their
+// arguments.
+func (f *fakeDB) ran(substr string) (queries []string, args [][]driver.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, query := range f.queries {
+		if strings.Contains(query, substr) {
+			queries = append(queries, query)
+			args = append(args, f.args[i])
+		}
+	}
+	return queries, args
+}
+
+type fakeConnector struct{ db *fakeDB }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{c.db}, nil
+}
+
+func (c fakeConnector) Driver() driver.Driver { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return nil, driver.ErrSkip }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.prepared++
+	return &fakeStmt{db: c.db, query: query, seq: c.db.prepared}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+	seq   int
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	res, err := s.db.run(s.seq, s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	res, err := s.db.run(s.seq, s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{res: res}, nil
+}
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+type fakeRows struct {
+	res  fakeResult
+	next int
+}
+
+func (r *fakeRows) Columns() []string { return r.res.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.res.rows) {
+		return io.EOF
+	}
+	copy(dest, r.res.rows[r.next])
+	r.next++
+	return nil
+}
+
+// requestWithSession returns a request carrying the cookie of the session
+// stored in the row with the given ID.
+func requestWithSession(t *testing.T, s *MariadbStore, name, id string) *http.Request {
+	t.Helper()
+	encoded, err := securecookie.EncodeMulti(s.cookieName(name), id, s.rowCodecsFor(name)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: name, Value: encoded})
+	return r
+}
+
+// serveRow makes db return a row with the given values and expiry when a
+// session is loaded.
+func serveRow(t *testing.T, s *MariadbStore, db *fakeDB, values map[interface{}]interface{}, expires time.Time) {
+	t.Helper()
+	session := sessions.NewSession(s, "session")
+	session.Values = values
+	data, err := s.encode(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+	db.setHandler(func(query string, args []driver.Value) (fakeResult, error) {
+		if !strings.HasPrefix(query, "SELECT `created_at`, `last_active`, `expires`, `session_data`") {
+			return fakeResult{rowsAffected: 1}, nil
+		}
+		return fakeResult{
+			columns: []string{"created_at", "last_active", "expires", "session_data"},
+			rows:    [][]driver.Value{{now, now, expires.Unix(), data}},
+		}, nil
+	})
+}
@@ -0,0 +1,48 @@
+package mariadbstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"regexp"
+	"strings"
+)
+
+// randomIDBytes is the entropy of the session IDs generated in Galera mode.
+const randomIDBytes = 32
+
+var idEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRandomID returns a session ID that can be generated on any node without
+// coordination.
+func newRandomID() (string, error) {
+	b := make([]byte, randomIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ToLower(idEncoding.EncodeToString(b)), nil
+}
+
+var assignmentPattern = regexp.MustCompile(`(\{\w+\})=\?`)
+
+// upsert turns the assignments of an INSERT ... SET into a statement that
+// updates the columns in update when the row already exists.
+func upsert(set, update string) string {
+	return `INSERT INTO {table} SET ` + set + ` ON DUPLICATE KEY UPDATE ` + assignmentPattern.ReplaceAllString(update, "$1=VALUES($1)")
+}
+
+// convertIDColumn changes an AUTO_INCREMENT ID column to hold generated IDs.
+// Existing sessions keep their numeric IDs.
+func (s *MariadbStore) convertIDColumn(ctx context.Context) error {
+	var dataType string
+	err := s.db.QueryRowContext(ctx, `SELECT DATA_TYPE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA=? AND TABLE_NAME=? AND COLUMN_NAME=?`,
+		s.databaseName, s.tableName, s.columns.ID).Scan(&dataType)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(dataType, "char") {
+		return nil
+	}
+	_, err = s.db.ExecContext(ctx, s.sql(`ALTER TABLE {table} MODIFY {id} VARCHAR(64) NOT NULL`))
+	return err
+}
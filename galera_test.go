@@ -0,0 +1,31 @@
+package mariadbstore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUpsert(t *testing.T) {
+	set := "{id}=?, {name}=?, {expires}=?, {session_data}=?"
+	want := "INSERT INTO {table} SET {id}=?, {name}=?, {expires}=?, {session_data}=? ON DUPLICATE KEY UPDATE {name}=VALUES({name}), {expires}=VALUES({expires}), {session_data}=VALUES({session_data})"
+	if got := upsert(set, set[len("{id}=?, "):]); got != want {
+		t.Errorf("upsert =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNewRandomID(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 100 {
+		id, err := newRandomID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := idEncoding.EncodedLen(randomIDBytes); len(id) != want || id != strings.ToLower(id) {
+			t.Fatalf("ID %q isn't a lower case ID of %d bytes", id, want)
+		}
+		if seen[id] {
+			t.Fatalf("ID %q was generated twice", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,76 @@
+package mariadbstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Healthy checks that the store can serve requests: the database answers, the
+// sessions table has the expected columns and prepared statements work.
+// It also fails when the background cleanup hasn't succeeded for two
+// intervals, naming the last successful cleanup, when the server's event
+// scheduler is off with WithDatabaseCleanup, or once the store is draining.
+// Use it for readiness probes, and LastSuccessfulCleanup to report when the
+// cleanup last succeeded.
+func (s *MariadbStore) Healthy(ctx context.Context) error {
+	if err := s.checkOpen(); err != nil {
+		return err
+	}
+	if s.drain.isDraining() {
+		return ErrStoreDraining
+	}
+
+	if p, ok := s.db.(pinger); ok {
+		if err := p.PingContext(ctx); err != nil {
+			return s.dbError(ctx, "ping", "", err)
+		}
+	}
+
+	if err := s.checkSchema(ctx); err != nil {
+		return err
+	}
+
+	var one int
+	if err := s.scanStmt(ctx, s.healthStmt, []any{&one}); err != nil {
+		return s.dbError(ctx, "health", "", err)
+	}
+
+	if err := s.checkEventScheduler(ctx); err != nil {
+		return err
+	}
+	return s.checkCleanup(time.Now())
+}
+
+// LastSuccessfulCleanup returns when the last cleanup run by this store that
+// succeeded started. The time is zero if none succeeded yet.
+func (s *MariadbStore) LastSuccessfulCleanup() time.Time {
+	t := s.lastCleanup.Load()
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, t)
+}
+
+// checkCleanup fails when the cleanup goroutine is overdue. Instances that
+// aren't the cleanup leader don't purge, so they aren't checked.
+func (s *MariadbStore) checkCleanup(now time.Time) error {
+	if s.cleanupInterval <= 0 || s.cleanupLock != "" {
+		return nil
+	}
+	last := s.LastSuccessfulCleanup()
+	if last.IsZero() {
+		if now.Sub(s.started) > 2*s.cleanupInterval {
+			return fmt.Errorf("session cleanup hasn't succeeded since the store started at %s", s.started.Format(time.RFC3339))
+		}
+		return nil
+	}
+	if now.Sub(last) > 2*s.cleanupInterval {
+		return fmt.Errorf("session cleanup hasn't succeeded since %s", last.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package mariadbstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+const expireBatchSize = 500
+
+// Hooks are called after the store creates, saves, deletes or expires a
+// session. Hooks run synchronously on the goroutine that made the change, so
+// slow work should be handed off. Changes made through GetLocked or SaveTx
+// are reported before their transaction commits.
+type Hooks struct {
+	OnCreate func(ctx context.Context, event SessionEvent)
+	OnSave   func(ctx context.Context, event SessionEvent)
+	// OnDelete is called when a session is deleted by Save with a negative
+	// MaxAge, by DeleteSessionByID or to enforce a session limit.
+	OnDelete func(ctx context.Context, event SessionEvent)
+	// OnExpire is called for every expired session purged by CleanExpired
+	// or WithDeleteExpiredOnLoad. Setting it, or using WithAuditLog, makes
+	// CleanExpired delete expired sessions one at a time.
+	OnExpire func(ctx context.Context, event SessionEvent)
+}
+
+// SessionEvent describes the session passed to a hook. Fields that aren't
+// known for the change are empty, e.g. the client of an expired session.
+type SessionEvent struct {
+	ID        string
+	Name      string
+	UserID    string
+	IP        string
+	UserAgent string
+	Time      time.Time
+}
+
+// event describes a change to session made by the request in ctx.
+func event(ctx context.Context, session *sessions.Session, now time.Time) SessionEvent {
+	c := clientFrom(ctx)
+	return SessionEvent{
+		ID:        session.ID,
+		Name:      session.Name(),
+		UserID:    UserID(session),
+		IP:        c.ip,
+		UserAgent: c.userAgent,
+		Time:      now,
+	}
+}
+
+// emit records the event in the audit table and calls its hook.
+func (s *MariadbStore) emit(ctx context.Context, kind auditEvent, e SessionEvent) {
+	s.audit(ctx, kind, e)
+
+	var hook func(context.Context, SessionEvent)
+	switch kind {
+	case auditCreate:
+		hook = s.hooks.OnCreate
+	case auditRefresh:
+		hook = s.hooks.OnSave
+	case auditDelete:
+		hook = s.hooks.OnDelete
+	case auditExpire:
+		hook = s.hooks.OnExpire
+	}
+	if hook != nil {
+		hook(ctx, e)
+	}
+}
+
+// reportsExpiry reports whether expired sessions must be purged one by one.
+func (s *MariadbStore) reportsExpiry() bool {
+	return s.hooks.OnExpire != nil || s.auditName != "" || s.expiryHandler != nil
+}
+
+// expiredRow is an expired session listed by the cleanup.
+type expiredRow struct {
+	id      string
+	name    string
+	created int64
+	expires int64
+	data    []byte
+}
+
+// cleanEach purges expired sessions one at a time so the expiry handler,
+// OnExpire and the audit log can see each of them.
+func (s *MariadbStore) cleanEach(ctx context.Context, now time.Time) (int64, error) {
+	var purged int64
+	lastID := ""
+	for {
+		expired, err := s.expiredBatch(ctx, now, lastID)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, row := range expired {
+			lastID = row.id
+			if !s.archive(ctx, row) {
+				continue
+			}
+
+			s.cache.remove(row.id)
+			res, err := s.execStmt(ctx, s.purgeStmt, row.id, now.Unix())
+			if err != nil {
+				return purged, s.dbError(ctx, "cleanup", row.id, err)
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return purged, err
+			}
+			// the session was extended after it was listed
+			if n == 0 {
+				continue
+			}
+			purged++
+			s.emit(ctx, auditExpire, SessionEvent{ID: row.id, Name: row.name, Time: now})
+		}
+
+		if len(expired) < expireBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// archive passes an expired session to the expiry handler and reports
+// whether it can be purged. Sessions the handler fails on are kept and
+// retried by the next cleanup.
+func (s *MariadbStore) archive(ctx context.Context, row expiredRow) bool {
+	if s.expiryHandler == nil {
+		return true
+	}
+
+	info := SessionInfo{ID: row.id, Name: row.name, Expires: time.Unix(row.expires, 0)}
+	if row.created > 0 {
+		info.Created = time.Unix(row.created, 0)
+	}
+	session := sessions.NewSession(s, row.name)
+	if err := s.decode(row.data, session); err == nil {
+		info.Values = session.Values
+	}
+
+	if err := s.expiryHandler(ctx, info); err != nil {
+		s.log(ctx, s.logLevels.Cleanup, "session expiry handler failed", "session_id", row.id, "error", err)
+		return false
+	}
+	return true
+}
+
+func (s *MariadbStore) expiredBatch(ctx context.Context, now time.Time, afterID string) ([]expiredRow, error) {
+	rows, err := s.queryStmt(ctx, s.expiredStmt, now.Unix(), afterID, expireBatchSize)
+	if err != nil {
+		return nil, s.dbError(ctx, "cleanup", "", err)
+	}
+	defer rows.Close()
+
+	var expired []expiredRow
+	for rows.Next() {
+		var row expiredRow
+		if err := rows.Scan(&row.id, &row.name, &row.created, &row.expires, &row.data); err != nil {
+			return nil, err
+		}
+		expired = append(expired, row)
+	}
+	return expired, rows.Err()
+}
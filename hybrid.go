@@ -0,0 +1,55 @@
+package mariadbstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// cookiePrefix marks cookies that hold the session values themselves rather
+// than the ID of a stored session. securecookie output never contains a dot.
+const cookiePrefix = "c."
+
+// valuesCookies reports whether sessions may be stored in the cookie itself,
+// with hybrid storage or the FailToCookie policy. Values cookies are rejected
+// otherwise.
+func (s *MariadbStore) valuesCookies() bool {
+	return s.hybridLimit > 0 || s.failurePolicy == FailToCookie
+}
+
+// valuesName returns the name values cookies are signed with. It differs
+// from the name the default serializer signs stored data with, so a
+// session_data blob can't be replayed as a cookie.
+func (s *MariadbStore) valuesName(name string) string {
+	return s.cookieName(name) + "#values"
+}
+
+// cookieValue encodes the session values into a cookie value.
+func (s *MariadbStore) cookieValue(session *sessions.Session) (string, error) {
+	encoded, err := securecookie.EncodeMulti(s.valuesName(session.Name()), session.Values, s.codecsFor(session.Name())...)
+	if err != nil {
+		return "", err
+	}
+	return cookiePrefix + encoded, nil
+}
+
+// writeCookie stores the session client-side. A row the session had while
+// it was larger is deleted.
+func (s *MariadbStore) writeCookie(ctx context.Context, w http.ResponseWriter, session *sessions.Session, value string) error {
+	if session.ID != "" {
+		if err := s.erase(ctx, session.ID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+		session.ID = ""
+	}
+	if err := s.commit(session); err != nil {
+		return err
+	}
+	track(session)
+
+	setCookie(ctx, w, session, value)
+	return nil
+}
@@ -0,0 +1,99 @@
+package mariadbstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// saveCookie saves the session and returns the cookie written for it.
+func saveCookie(t *testing.T, s *MariadbStore, session *sessions.Session) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := s.Save(httptest.NewRequest(http.MethodGet, "/", nil), w, session); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Save wrote %d cookies, want 1", len(cookies))
+	}
+	return cookies[0]
+}
+
+func TestHybridStorage(t *testing.T) {
+	s, db := newFakeStore(t, WithHybridStorage(300))
+	session, err := s.New(httptest.NewRequest(http.MethodGet, "/", nil), "session")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	session.Values["user"] = "alice"
+	c := saveCookie(t, s, session)
+	if !strings.HasPrefix(c.Value, cookiePrefix) || session.ID != "" {
+		t.Errorf("small session was stored with the ID %q and the cookie %q", session.ID, c.Value)
+	}
+	if queries, _ := db.ran("INSERT"); len(queries) != 0 {
+		t.Errorf("small session was inserted: %q", queries)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(c)
+	session, err = s.New(r, "session")
+	if err != nil {
+		t.Fatalf("New from the values cookie: %v", err)
+	}
+	if session.IsNew || session.Values["user"] != "alice" {
+		t.Errorf("values cookie loaded %v, new %v", session.Values, session.IsNew)
+	}
+
+	session.Values["bio"] = strings.Repeat("x", 500)
+	c = saveCookie(t, s, session)
+	if strings.HasPrefix(c.Value, cookiePrefix) || session.ID == "" {
+		t.Errorf("large session was kept in the cookie %q", c.Value)
+	}
+	if queries, _ := db.ran("INSERT"); len(queries) != 1 {
+		t.Errorf("large session was inserted %d times, want once", len(queries))
+	}
+}
+
+func TestHybridStorageShrink(t *testing.T) {
+	s, db := newFakeStore(t, WithHybridStorage(300))
+	serveRow(t, s, db, map[interface{}]interface{}{"bio": strings.Repeat("x", 500)}, time.Now().Add(time.Hour))
+	session, err := s.New(requestWithSession(t, s, "session", "5"), "session")
+	if err != nil || session.ID != "5" {
+		t.Fatalf("New = %q, %v, want the stored session", session.ID, err)
+	}
+
+	delete(session.Values, "bio")
+	c := saveCookie(t, s, session)
+	if !strings.HasPrefix(c.Value, cookiePrefix) || session.ID != "" {
+		t.Errorf("shrunk session was stored with the ID %q and the cookie %q", session.ID, c.Value)
+	}
+	if _, args := db.ran("DELETE"); len(args) != 1 || args[0][0] != "5" {
+		t.Errorf("row of the shrunk session wasn't deleted: %v", args)
+	}
+}
+
+func TestValuesCookieWithoutHybridStorage(t *testing.T) {
+	hybrid, _ := newFakeStore(t, WithHybridStorage(300))
+	session, err := hybrid.New(httptest.NewRequest(http.MethodGet, "/", nil), "session")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	session.Values["user"] = "alice"
+	c := saveCookie(t, hybrid, session)
+
+	s, _ := newFakeStore(t)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(c)
+	session, err = s.New(r, "session")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if !session.IsNew || len(session.Values) != 0 {
+		t.Errorf("values cookie was accepted without hybrid storage: %v", session.Values)
+	}
+}
@@ -0,0 +1,120 @@
+package mariadbstore
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxIdentifierLength is the longest database, table or column name MariaDB
+// accepts, in characters.
+const maxIdentifierLength = 64
+
+// checkIdentifier fails for names MariaDB doesn't accept even when quoted.
+func checkIdentifier(kind, name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("%s name cannot be empty", kind)
+	case !utf8.ValidString(name):
+		return fmt.Errorf("%s name %q isn't valid UTF-8", kind, name)
+	case utf8.RuneCountInString(name) > maxIdentifierLength:
+		return fmt.Errorf("%s name %q is longer than %d characters", kind, name, maxIdentifierLength)
+	case strings.HasSuffix(name, " "):
+		return fmt.Errorf("%s name %q cannot end with a space", kind, name)
+	}
+	for _, r := range name {
+		// MariaDB identifiers can't hold NUL or characters outside the BMP
+		if r == 0 || r > 0xFFFF {
+			return fmt.Errorf("%s name %q contains the invalid character %U", kind, name, r)
+		}
+	}
+	return nil
+}
+
+// namePattern matches the engine, character set and collation names, which
+// are used in statements without quotes.
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// checkName fails for engine, character set and collation names that aren't
+// plain words.
+func checkName(kind, name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("%s %q may only contain letters, digits and underscores", kind, name)
+	}
+	return nil
+}
+
+// checkIdentifiers validates the database, table and column names, and the
+// names derived from them, before they are used in statements.
+func (s *MariadbStore) checkIdentifiers() error {
+	if err := checkIdentifier("database", s.databaseName); err != nil {
+		return err
+	}
+	tables := []string{s.tableName}
+	// Migrate and SchemaVersion check the version table themselves
+	if s.autoMigrate {
+		tables = append(tables, s.versionTable())
+	}
+	if s.auditName != "" {
+		tables = append(tables, s.auditName)
+	}
+	for _, name := range tables {
+		if err := checkIdentifier("table", name); err != nil {
+			return err
+		}
+	}
+	if s.dbCleanup > 0 {
+		if err := checkIdentifier("event", s.cleanupEvent()); err != nil {
+			return err
+		}
+	}
+
+	c := s.columns
+	for _, name := range []string{c.ID, c.Name, c.CreatedAt, c.LastActive, c.Expires, c.Data, c.UpdatedAt, c.ClientIP, c.UserAgent, c.Fingerprint, c.UserID, c.Options, c.DeletedAt} {
+		if err := checkIdentifier("column", name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quoteIdentifier quotes name with backticks so it can hold any character
+// MariaDB allows in identifiers.
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// qualified returns the quoted name of a table or event in the sessions
+// database.
+func (s *MariadbStore) qualified(name string) string {
+	return quoteIdentifier(s.databaseName) + "." + quoteIdentifier(name)
+}
+
+func (s *MariadbStore) versionTable() string {
+	return s.tableName + "_schema_version"
+}
+
+func (s *MariadbStore) cleanupEvent() string {
+	return s.tableName + "_cleanup"
+}
+
+// quoted returns the column names quoted for use in statements.
+func (c Columns) quoted() Columns {
+	q := quoteIdentifier
+	return Columns{
+		ID:          q(c.ID),
+		Name:        q(c.Name),
+		CreatedAt:   q(c.CreatedAt),
+		LastActive:  q(c.LastActive),
+		Expires:     q(c.Expires),
+		Data:        q(c.Data),
+		UpdatedAt:   q(c.UpdatedAt),
+		ClientIP:    q(c.ClientIP),
+		UserAgent:   q(c.UserAgent),
+		Fingerprint: q(c.Fingerprint),
+		UserID:      q(c.UserID),
+		Options:     q(c.Options),
+		DeletedAt:   q(c.DeletedAt),
+	}
+}
@@ -0,0 +1,60 @@
+package mariadbstore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckIdentifier(t *testing.T) {
+	valid := []string{"sessions", "user-sessions", "select", "sessions v2", "sitzungen_ä", strings.Repeat("é", maxIdentifierLength)}
+	for _, name := range valid {
+		if err := checkIdentifier("table", name); err != nil {
+			t.Errorf("checkIdentifier(%q): %v", name, err)
+		}
+	}
+
+	invalid := []string{"", strings.Repeat("a", maxIdentifierLength+1), "sessions ", "ses\x00sions", "sessions😀", "\xff"}
+	for _, name := range invalid {
+		if err := checkIdentifier("table", name); err == nil {
+			t.Errorf("checkIdentifier(%q) succeeded", name)
+		}
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	for _, name := range []string{"InnoDB", "utf8mb4", "utf8mb4_unicode_ci"} {
+		if err := checkName("engine", name); err != nil {
+			t.Errorf("checkName(%q): %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "InnoDB; DROP TABLE sessions", "utf8mb4 COLLATE x", "`InnoDB`"} {
+		if err := checkName("engine", name); err == nil {
+			t.Errorf("checkName(%q) succeeded", name)
+		}
+	}
+
+	if _, err := newTestStore(t, WithEngine("InnoDB, x")); err == nil {
+		t.Error("store with an invalid engine was created")
+	}
+	if _, err := newTestStore(t, WithCharset("utf8mb4", "x'")); err == nil {
+		t.Error("store with an invalid collation was created")
+	}
+	if _, err := newTestStore(t, WithCharset("", "")); err != nil {
+		t.Errorf("store with the default charset: %v", err)
+	}
+}
+
+func TestCheckIdentifiersVersionTable(t *testing.T) {
+	// too long for the version table, which migrations need
+	table := strings.Repeat("t", maxIdentifierLength-5)
+	s := testStore(t)
+	s.tableName = table
+	if err := s.checkIdentifiers(); err != nil {
+		t.Errorf("table name of %d characters without migrations: %v", len(table), err)
+	}
+
+	s.autoMigrate = true
+	if err := s.checkIdentifiers(); err == nil {
+		t.Errorf("table name of %d characters was accepted with migrations", len(table))
+	}
+}
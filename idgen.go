@@ -0,0 +1,45 @@
+package mariadbstore
+
+import (
+	"context"
+	"fmt"
+)
+
+// maxIDLength is the size of the string ID column.
+const maxIDLength = 64
+
+// IDGenerator generates the IDs of new sessions, e.g. UUIDv7s, ULIDs or IDs
+// issued by an external service. IDs must be unique and at most 64 bytes
+// long; they are stored as strings and only ever compared for equality.
+type IDGenerator interface {
+	NewID(ctx context.Context) (string, error)
+}
+
+// IDGeneratorFunc adapts a function to an IDGenerator.
+type IDGeneratorFunc func(ctx context.Context) (string, error)
+
+func (f IDGeneratorFunc) NewID(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// stringIDs reports whether the store generates session IDs itself instead
+// of using AUTO_INCREMENT values.
+func (s *MariadbStore) stringIDs() bool {
+	return s.galera || s.idGenerator != nil
+}
+
+// newID returns the ID of a new session from the IDGenerator, or a random
+// one in Galera mode.
+func (s *MariadbStore) newID(ctx context.Context) (string, error) {
+	if s.idGenerator == nil {
+		return newRandomID()
+	}
+	id, err := s.idGenerator.NewID(ctx)
+	if err != nil {
+		return "", fmt.Errorf("generating session ID: %w", err)
+	}
+	if id == "" || len(id) > maxIDLength {
+		return "", fmt.Errorf("generated session ID %q must be 1 to %d bytes long", id, maxIDLength)
+	}
+	return id, nil
+}
@@ -0,0 +1,63 @@
+package mariadbstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var (
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+	jsonPathPattern   = regexp.MustCompile(`^\$(\.[A-Za-z_][A-Za-z0-9_]*|\[[0-9]+\])*$`)
+)
+
+// indexedField is a generated column extracting a value from the JSON data.
+type indexedField struct {
+	column string
+	path   string
+}
+
+// checkJSONStorage validates the options combined with WithJSONStorage.
+func (s *MariadbStore) checkJSONStorage() error {
+	if !s.jsonStorage {
+		if len(s.indexedFields) > 0 {
+			return errors.New("indexed fields require WithJSONStorage")
+		}
+		return nil
+	}
+	if s.keyring != nil || s.compression != NoCompression {
+		return errors.New("JSON storage can't be combined with encryption or compression")
+	}
+	switch s.serializer.(type) {
+	case securecookieSerializer, JSONSerializer:
+		s.serializer = JSONSerializer{}
+	default:
+		return errors.New("JSON storage requires the JSON serializer")
+	}
+
+	c := s.columns
+	for _, f := range s.indexedFields {
+		switch f.column {
+		case c.ID, c.Name, c.CreatedAt, c.LastActive, c.Expires, c.Data, c.UpdatedAt, c.ClientIP, c.UserAgent, c.Fingerprint, c.UserID, c.Options, c.DeletedAt:
+			return fmt.Errorf("indexed field %s clashes with a sessions table column", f.column)
+		}
+	}
+	return nil
+}
+
+// createIndexedFields adds a virtual column and an index for every field set
+// with WithIndexedField.
+func (s *MariadbStore) createIndexedFields(ctx context.Context) error {
+	for _, f := range s.indexedFields {
+		query := fmt.Sprintf(`
+			ALTER TABLE {table}
+				ADD COLUMN IF NOT EXISTS %[1]s VARCHAR(255) AS (JSON_VALUE({session_data}, '%[2]s')) VIRTUAL,
+				ADD INDEX IF NOT EXISTS %[1]s (%[1]s)
+		`, quoteIdentifier(f.column), f.path)
+		if _, err := s.db.ExecContext(ctx, s.sql(query)); err != nil {
+			return fmt.Errorf("indexed field %s: %w", f.column, err)
+		}
+	}
+	return nil
+}
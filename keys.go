@@ -0,0 +1,127 @@
+package mariadbstore
+
+import (
+	"context"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+const reencodeBatchSize = 500
+
+// SetKeyPairs replaces the securecookie key pairs at runtime. As with
+// NewMariadbStore the first pair is used to encode and the remaining pairs
+// are still accepted when decoding, so pass the new pair followed by the old
+// ones until every cookie and stored session has been re-encoded.
+func (s *MariadbStore) SetKeyPairs(keyPairs ...[]byte) {
+	s.codecsMu.Lock()
+	s.keyPairs = keyPairs
+	s.rebuildCodecs()
+	s.codecsMu.Unlock()
+
+	s.eachTenant(func(t *MariadbStore) { t.SetKeyPairs(keyPairs...) })
+}
+
+// rebuildCodecs applies the options MaxAge and MaxLength to the codecs. Fresh
+// codecs replace the old ones, so requests using them aren't affected,
+// including those of registered sessions. Without key pairs the codecs
+// assigned to Codecs can't be rebuilt, and changing them in place would race
+// with those requests, so they're left alone. It must be called with
+// codecsMu held.
+func (s *MariadbStore) rebuildCodecs() {
+	if s.keyPairs == nil {
+		return
+	}
+	codecs := securecookie.CodecsFromPairs(s.keyPairs...)
+	for _, c := range codecs {
+		if codec, ok := c.(*securecookie.SecureCookie); ok {
+			codec.MaxAge(s.Options.MaxAge)
+			if s.maxLength >= 0 {
+				codec.MaxLength(s.maxLength)
+			}
+		}
+	}
+	s.Codecs = codecs
+	s.rowCodecs = timelessCodecs(s.keyPairs, s.maxLength)
+
+	for _, n := range s.named {
+		if n.derived {
+			n.codecs = s.derivedCodecs(n.options.MaxAge)
+		}
+	}
+}
+
+// Reencode rewrites every stored session with the current key pairs and
+// encryption keyring. It is safe to run in the background while the store
+// serves traffic: a row that is saved concurrently is left alone. Rows that
+// can't be decoded with the current keys are skipped. It returns the number
+// of rewritten rows.
+func (s *MariadbStore) Reencode(ctx context.Context) (int64, error) {
+	if err := s.checkOpen(); err != nil {
+		return 0, err
+	}
+	if err := s.drain.beginWrite(); err != nil {
+		return 0, err
+	}
+	defer s.drain.endWrite()
+
+	var rewritten int64
+	lastID := ""
+	for {
+		batch, err := s.nextBatch(ctx, lastID)
+		if err != nil {
+			return rewritten, err
+		}
+		if len(batch) == 0 {
+			return rewritten, nil
+		}
+
+		for _, row := range batch {
+			session := sessions.NewSession(s, row.name)
+			session.ID = row.id
+			if err := s.decode(row.data, session); err != nil {
+				continue
+			}
+
+			encoded, err := s.encode(session)
+			if err != nil {
+				return rewritten, err
+			}
+
+			res, err := s.execStmt(ctx, s.rewriteStmt, encoded, row.id, row.data)
+			if err != nil {
+				return rewritten, err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return rewritten, err
+			}
+			rewritten += n
+		}
+		lastID = batch[len(batch)-1].id
+	}
+}
+
+type storedRow struct {
+	id   string
+	name string
+	data []byte
+}
+
+func (s *MariadbStore) nextBatch(ctx context.Context, afterID string) ([]storedRow, error) {
+	rows, err := s.queryStmt(ctx, s.batchStmt, afterID, reencodeBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []storedRow
+	for rows.Next() {
+		var row storedRow
+		if err := rows.Scan(&row.id, &row.name, &row.data); err != nil {
+			return nil, err
+		}
+		batch = append(batch, row)
+	}
+	return batch, rows.Err()
+}
@@ -0,0 +1,80 @@
+package mariadbstore
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// MariaDB limits user lock names to 64 characters.
+const maxLockNameLength = 64
+
+// lead reports whether this instance is the cleanup leader, trying to become
+// it if nobody else is. Leadership is a GET_LOCK held on a dedicated
+// connection, so it moves to another instance when the leader exits or its
+// connection drops.
+func (s *MariadbStore) lead(ctx context.Context) bool {
+	if s.lockConn != nil {
+		var held bool
+		err := s.lockConn.QueryRowContext(ctx, `SELECT COALESCE(IS_USED_LOCK(?) = CONNECTION_ID(), 0)`, s.cleanupLock).Scan(&held)
+		if err == nil && held {
+			return true
+		}
+		s.lockConn.Close()
+		s.lockConn = nil
+	}
+
+	conn, err := s.acquireLock(ctx, s.cleanupLock, 0)
+	if err != nil || conn == nil {
+		return false
+	}
+
+	s.lockConn = conn
+	return true
+}
+
+// resign gives up cleanup leadership.
+func (s *MariadbStore) resign() {
+	if s.lockConn == nil {
+		return
+	}
+	releaseLock(s.lockConn, s.cleanupLock)
+	s.lockConn = nil
+}
+
+// acquireLock takes the named lock on a dedicated connection, waiting up to
+// timeout for it. It returns a nil connection if the lock is held elsewhere.
+func (s *MariadbStore) acquireLock(ctx context.Context, name string, timeout time.Duration) (*sql.Conn, error) {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, `SELECT COALESCE(GET_LOCK(?, ?), 0)`, name, timeout.Seconds()).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !acquired {
+		conn.Close()
+		return nil, nil
+	}
+	return conn, nil
+}
+
+func releaseLock(conn *sql.Conn, name string) {
+	conn.ExecContext(context.Background(), `DO RELEASE_LOCK(?)`, name)
+	conn.Close()
+}
+
+func defaultLockName(purpose, databaseName, tableName string) string {
+	name := fmt.Sprintf("mariadbstore:%s:%s.%s", purpose, databaseName, tableName)
+	if len(name) <= maxLockNameLength {
+		return name
+	}
+	sum := sha1.Sum([]byte(name))
+	return "mariadbstore:" + purpose + ":" + hex.EncodeToString(sum[:])
+}
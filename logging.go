@@ -0,0 +1,50 @@
+package mariadbstore
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Logger receives log records from the store. *slog.Logger implements it.
+type Logger interface {
+	Log(ctx context.Context, level slog.Level, msg string, args ...any)
+}
+
+// LogLevels sets the level each kind of store event is logged at.
+type LogLevels struct {
+	// Cleanup is used when a background cleanup run fails.
+	Cleanup slog.Level
+	// Decode is used when a session cookie or stored session can't be
+	// decoded. This happens routinely after key rotation, so it defaults
+	// to warn.
+	Decode slog.Level
+	// DB is used when a query fails.
+	DB slog.Level
+}
+
+var defaultLogLevels = LogLevels{
+	Cleanup: slog.LevelError,
+	Decode:  slog.LevelWarn,
+	DB:      slog.LevelError,
+}
+
+func (s *MariadbStore) log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	if s.logger != nil {
+		s.logger.Log(ctx, level, msg, args...)
+	}
+}
+
+// dbError records a failed query and wraps err with ErrStoreUnavailable. id
+// is the affected session, if any.
+func (s *MariadbStore) dbError(ctx context.Context, op, id string, err error) error {
+	s.metrics.DBError(op)
+
+	args := []any{"op", op, "error", err}
+	if id != "" {
+		args = append(args, "session_id", id)
+	}
+	s.log(ctx, s.logLevels.DB, "session store query failed", args...)
+
+	return fmt.Errorf("%w: %s: %w", ErrStoreUnavailable, op, err)
+}
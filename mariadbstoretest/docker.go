@@ -0,0 +1,90 @@
+package mariadbstoretest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// DSNEnv names the environment variable MariaDB reads the DSN of an existing
+// test server from.
+const DSNEnv = "MARIADBSTORE_TEST_DSN"
+
+// Image is the MariaDB image MariaDB starts.
+var Image = "mariadb:11"
+
+const startTimeout = 2 * time.Minute
+
+// MariaDB returns the DSN of a MariaDB server for integration tests. It uses
+// the server in the MARIADBSTORE_TEST_DSN environment variable when it is
+// set, and otherwise starts a throwaway container with docker that is
+// removed when the test finishes. The test is skipped if neither is
+// available.
+func MariaDB(t testing.TB) string {
+	t.Helper()
+	if dsn := os.Getenv(DSNEnv); dsn != "" {
+		return dsn
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skipf("%s isn't set and docker isn't available", DSNEnv)
+	}
+
+	out, err := exec.Command("docker", "run", "-d", "--rm", "-p", "127.0.0.1::3306",
+		"-e", "MARIADB_ROOT_PASSWORD=test", "-e", "MARIADB_DATABASE=sessions", Image).Output()
+	if err != nil {
+		t.Fatalf("starting %s: %v", Image, commandError(err))
+	}
+	container := strings.TrimSpace(string(out))
+	t.Cleanup(func() {
+		exec.Command("docker", "rm", "-f", container).Run()
+	})
+
+	out, err = exec.Command("docker", "port", container, "3306/tcp").Output()
+	if err != nil {
+		t.Fatalf("finding the MariaDB port: %v", commandError(err))
+	}
+	addr := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	dsn := fmt.Sprintf("root:test@tcp(%s)/sessions", addr)
+
+	if err := waitReady(dsn); err != nil {
+		t.Fatalf("MariaDB didn't start: %v", err)
+	}
+	return dsn
+}
+
+// waitReady waits until the server accepts connections.
+func waitReady(dsn string) error {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+	for {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func commandError(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
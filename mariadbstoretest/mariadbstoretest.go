@@ -0,0 +1,140 @@
+// Package mariadbstoretest checks that a sessions.Store behaves like
+// mariadbstore, and starts MariaDB servers for integration tests.
+package mariadbstoretest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+const sessionName = "mariadbstoretest"
+
+// Run runs the conformance suite against stores created by newStore. Each
+// subtest gets its own store, which newStore should close with t.Cleanup.
+func Run(t *testing.T, newStore func(t *testing.T) sessions.Store) {
+	t.Run("NewSession", func(t *testing.T) {
+		store := newStore(t)
+		session, err := store.New(httptest.NewRequest(http.MethodGet, "/", nil), sessionName)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		if !session.IsNew {
+			t.Error("session from a request without a cookie isn't new")
+		}
+		if len(session.Values) != 0 {
+			t.Errorf("new session has values %v", session.Values)
+		}
+	})
+
+	t.Run("SaveAndLoad", func(t *testing.T) {
+		store := newStore(t)
+		session := newSession(t, store, nil)
+		session.Values["user"] = "alice"
+		session.Values["visits"] = 3
+		cookie := save(t, store, session)
+
+		loaded := newSession(t, store, cookie)
+		if loaded.IsNew {
+			t.Fatal("saved session was loaded as a new session")
+		}
+		if loaded.Values["user"] != "alice" || loaded.Values["visits"] != 3 {
+			t.Errorf("loaded values %v, want user alice and 3 visits", loaded.Values)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		store := newStore(t)
+		session := newSession(t, store, nil)
+		session.Values["step"] = 1
+		cookie := save(t, store, session)
+
+		session = newSession(t, store, cookie)
+		session.Values["step"] = 2
+		if c := save(t, store, session); c != nil {
+			cookie = c
+		}
+
+		if step := newSession(t, store, cookie).Values["step"]; step != 2 {
+			t.Errorf("step = %v after update, want 2", step)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		store := newStore(t)
+		session := newSession(t, store, nil)
+		session.Values["user"] = "alice"
+		cookie := save(t, store, session)
+
+		session = newSession(t, store, cookie)
+		session.Options.MaxAge = -1
+		if c := save(t, store, session); c == nil || c.MaxAge >= 0 {
+			t.Error("deleting a session doesn't expire its cookie")
+		}
+
+		if !newSession(t, store, cookie).IsNew {
+			t.Error("deleted session can still be loaded")
+		}
+	})
+
+	t.Run("TamperedCookie", func(t *testing.T) {
+		store := newStore(t)
+		session := newSession(t, store, nil)
+		session.Values["user"] = "alice"
+		cookie := save(t, store, session)
+		cookie.Value = "x" + cookie.Value
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(cookie)
+		// the error is deliberately ignored, stores may report the bad cookie
+		tampered, _ := store.New(r, sessionName)
+		if tampered == nil || !tampered.IsNew || tampered.Values["user"] != nil {
+			t.Error("session with a tampered cookie wasn't replaced by a new one")
+		}
+	})
+
+	t.Run("Names", func(t *testing.T) {
+		store := newStore(t)
+		session := newSession(t, store, nil)
+		session.Values["user"] = "alice"
+		cookie := save(t, store, session)
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: "other", Value: cookie.Value})
+		other, _ := store.New(r, "other")
+		if other == nil || !other.IsNew {
+			t.Error("a cookie was accepted under another session name")
+		}
+	})
+}
+
+// newSession loads the test session from a request carrying cookie, if any.
+func newSession(t *testing.T, store sessions.Store, cookie *http.Cookie) *sessions.Session {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	session, err := store.New(r, sessionName)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return session
+}
+
+// save saves session and returns the cookie it set, if any.
+func save(t *testing.T, store sessions.Store, session *sessions.Session) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := store.Save(httptest.NewRequest(http.MethodGet, "/", nil), w, session); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == session.Name() {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Package memstore is an in-memory sessions.Store for unit tests of code
+// that uses mariadbstore. It keeps sessions by ID like mariadbstore does and
+// encodes their values with gob, so values that can't be stored by the real
+// store fail here too.
+package memstore
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+type entry struct {
+	data    []byte
+	expires time.Time
+}
+
+// Store keeps sessions in memory. It is safe for concurrent use.
+type Store struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+
+	mu       sync.Mutex
+	sessions map[string]entry
+}
+
+var _ sessions.Store = (*Store)(nil)
+
+// New returns an empty store whose cookies are encoded with keyPairs.
+func New(keyPairs ...[]byte) *Store {
+	return &Store{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   86400 * 30,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+		sessions: make(map[string]entry),
+	}
+}
+
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var id string
+	if err := securecookie.DecodeMulti(name, c.Value, &id, s.Codecs...); err != nil {
+		return session, err
+	}
+
+	s.mu.Lock()
+	e, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok || !time.Now().Before(e.expires) {
+		return session, nil
+	}
+	if err := (securecookie.GobEncoder{}).Deserialize(e.data, &session.Values); err != nil {
+		return session, err
+	}
+	session.ID = id
+	session.IsNew = false
+	return session, nil
+}
+
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		s.Delete(session.ID)
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	data, err := (securecookie.GobEncoder{}).Serialize(session.Values)
+	if err != nil {
+		return err
+	}
+	if session.ID == "" {
+		if session.ID, err = newID(); err != nil {
+			return err
+		}
+	}
+
+	maxAge := time.Duration(session.Options.MaxAge) * time.Second
+	if maxAge == 0 {
+		maxAge = 24 * time.Hour
+	}
+	s.mu.Lock()
+	s.sessions[session.ID] = entry{data: data, expires: time.Now().Add(maxAge)}
+	s.mu.Unlock()
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// Delete removes the session with the given ID.
+func (s *Store) Delete(id string) {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+}
+
+// Len returns the number of stored sessions, including expired ones.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
@@ -0,0 +1,67 @@
+package memstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/agorman/mariadbstore/mariadbstoretest"
+	"github.com/gorilla/sessions"
+)
+
+func TestStore(t *testing.T) {
+	mariadbstoretest.Run(t, func(t *testing.T) sessions.Store {
+		return New([]byte("secret"))
+	})
+}
+
+func TestDeleteAndLen(t *testing.T) {
+	store := New([]byte("secret"))
+	session, err := store.New(httptest.NewRequest(http.MethodGet, "/", nil), "session")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	session.Values["user"] = "alice"
+	if err := store.Save(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if n := store.Len(); n != 1 {
+		t.Fatalf("Len = %d after saving a session, want 1", n)
+	}
+
+	store.Delete(session.ID)
+	if n := store.Len(); n != 0 {
+		t.Errorf("Len = %d after deleting the session, want 0", n)
+	}
+}
+
+func TestExpiredSession(t *testing.T) {
+	store := New([]byte("secret"))
+	session, err := store.New(httptest.NewRequest(http.MethodGet, "/", nil), "session")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	session.Values["user"] = "alice"
+	w := httptest.NewRecorder()
+	if err := store.Save(httptest.NewRequest(http.MethodGet, "/", nil), w, session); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	store.mu.Lock()
+	e := store.sessions[session.ID]
+	e.expires = e.expires.AddDate(-1, 0, 0)
+	store.sessions[session.ID] = e
+	store.mu.Unlock()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	loaded, err := store.New(r, "session")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if !loaded.IsNew || loaded.Values["user"] != nil {
+		t.Error("expired session was loaded")
+	}
+}
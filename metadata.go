@@ -0,0 +1,129 @@
+package mariadbstore
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+const maxUserAgentLength = 512
+
+type clientKey struct{}
+
+// client describes the request a session is saved from.
+type client struct {
+	ip          string
+	userAgent   string
+	fingerprint []byte
+}
+
+// RemoteAddrIP returns the host part of r.RemoteAddr. It is the default way
+// WithSessionMetadata finds the client IP.
+func RemoteAddrIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// withClient records the client of r in ctx when session metadata is stored
+// or sessions are bound to their client.
+func (s *MariadbStore) withClient(ctx context.Context, r *http.Request) context.Context {
+	if (!s.metadata && !s.binding.enabled()) || r == nil {
+		return ctx
+	}
+	c := client{
+		ip:        s.clientIP(r),
+		userAgent: truncate(r.UserAgent(), maxUserAgentLength),
+	}
+	if s.binding.enabled() {
+		c.fingerprint = s.binding.fingerprint(c.ip, r)
+	}
+	return context.WithValue(ctx, clientKey{}, c)
+}
+
+func clientFrom(ctx context.Context) client {
+	c, _ := ctx.Value(clientKey{}).(client)
+	return c
+}
+
+// metaColumns returns the SET clause for the optional columns that are in
+// use. The updated_at and fingerprint columns are left
+// out of touches, which don't change the data.
+func (s *MariadbStore) metaColumns(updated bool) string {
+	var set string
+	if s.metadata {
+		if updated {
+			set += ", {updated_at}=?"
+		}
+		set += ", {client_ip}=?, {user_agent}=?"
+	}
+	if s.binding.enabled() && updated {
+		set += ", {fingerprint}=?"
+	}
+	if s.maxPerUser > 0 && updated {
+		set += ", {user_id}=?"
+	}
+	if s.persistOptions {
+		set += ", {options}=?"
+	}
+	return set
+}
+
+// metaSelect returns the metadata columns to select in listings.
+func (s *MariadbStore) metaSelect() string {
+	if !s.metadata {
+		return ""
+	}
+	return ", {updated_at}, {client_ip}, {user_agent}"
+}
+
+// loadColumns returns the optional columns to select when loading sessions.
+func (s *MariadbStore) loadColumns() string {
+	var columns string
+	if s.binding.enabled() {
+		columns += ", {fingerprint}"
+	}
+	if s.maxPerUser > 0 {
+		columns += ", {user_id}"
+	}
+	if s.persistOptions {
+		columns += ", {options}"
+	}
+	return columns
+}
+
+// metaArgs returns the arguments for the clause built by metaColumns.
+func (s *MariadbStore) metaArgs(ctx context.Context, session *sessions.Session, now time.Time, updated bool) []any {
+	var args []any
+	c := clientFrom(ctx)
+	if s.metadata {
+		if updated {
+			args = append(args, now.Unix())
+		}
+		args = append(args, c.ip, c.userAgent)
+	}
+	if s.binding.enabled() && updated {
+		args = append(args, c.fingerprint)
+	}
+	if s.maxPerUser > 0 && updated {
+		args = append(args, UserID(session))
+	}
+	if s.persistOptions {
+		args = append(args, s.encodeOptions(session))
+	}
+	return args
+}
+
+// truncate shortens s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -0,0 +1,70 @@
+package mariadbstore
+
+import (
+	"expvar"
+	"time"
+)
+
+// Metrics receives events about store activity. Implementations must be safe
+// for concurrent use. Adapt it to Prometheus or another metrics system, or
+// use ExpvarMetrics.
+type Metrics interface {
+	SessionCreated()
+	SessionLoaded()
+	SessionSaved()
+	SessionDeleted()
+	// CleanupFinished is called after each cleanup run with its duration and
+	// the number of purged sessions.
+	CleanupFinished(duration time.Duration, purged int64)
+	// DBError is called when a query fails. op names the operation, e.g.
+	// "insert", "load", "save", "touch", "delete" or "cleanup".
+	DBError(op string)
+	// PayloadSize is called with the size in bytes of each written session.
+	PayloadSize(bytes int)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) SessionCreated()                      {}
+func (noopMetrics) SessionLoaded()                       {}
+func (noopMetrics) SessionSaved()                        {}
+func (noopMetrics) SessionDeleted()                      {}
+func (noopMetrics) CleanupFinished(time.Duration, int64) {}
+func (noopMetrics) DBError(string)                       {}
+func (noopMetrics) PayloadSize(int)                      {}
+
+// ExpvarMetrics publishes store counters as an expvar map.
+type ExpvarMetrics struct {
+	m *expvar.Map
+}
+
+// NewExpvarMetrics publishes the counters under the given expvar name. It
+// reuses an existing map so several stores can share a name.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	m, ok := expvar.Get(name).(*expvar.Map)
+	if !ok {
+		m = expvar.NewMap(name)
+	}
+	return &ExpvarMetrics{m: m}
+}
+
+func (e *ExpvarMetrics) SessionCreated() { e.m.Add("sessions_created", 1) }
+func (e *ExpvarMetrics) SessionLoaded()  { e.m.Add("sessions_loaded", 1) }
+func (e *ExpvarMetrics) SessionSaved()   { e.m.Add("sessions_saved", 1) }
+func (e *ExpvarMetrics) SessionDeleted() { e.m.Add("sessions_deleted", 1) }
+
+func (e *ExpvarMetrics) CleanupFinished(duration time.Duration, purged int64) {
+	e.m.Add("cleanup_runs", 1)
+	e.m.Add("cleanup_purged", purged)
+	e.m.AddFloat("cleanup_seconds", duration.Seconds())
+}
+
+func (e *ExpvarMetrics) DBError(op string) {
+	e.m.Add("db_errors", 1)
+	e.m.Add("db_errors_"+op, 1)
+}
+
+func (e *ExpvarMetrics) PayloadSize(bytes int) {
+	e.m.Add("payload_writes", 1)
+	e.m.Add("payload_bytes", int64(bytes))
+}
@@ -0,0 +1,162 @@
+package mariadbstore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+type sessionKey struct{}
+
+// FromContext returns the session loaded by Middleware, or nil if the request
+// didn't pass through it.
+func FromContext(ctx context.Context) *sessions.Session {
+	session, _ := ctx.Value(sessionKey{}).(*sessions.Session)
+	return session
+}
+
+// MiddlewareOption configures Middleware.
+type MiddlewareOption func(*middleware)
+
+// WithMiddlewareErrorHandler sets the function that responds when the session
+// can't be loaded or saved. The default responds with 500 Internal Server
+// Error.
+func WithMiddlewareErrorHandler(h func(w http.ResponseWriter, r *http.Request, err error)) MiddlewareOption {
+	return func(m *middleware) {
+		m.onError = h
+	}
+}
+
+type middleware struct {
+	store   *MariadbStore
+	name    string
+	onError func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Middleware loads the named session into the request context, where
+// handlers get it with FromContext, and saves it if it has changed before
+// the response is written. Sessions that haven't changed are only saved to
+// extend their expiry with WithTouchOnRead, or with WithSkipUnchanged once
+// half of their lifetime has passed. A stolen session reported with
+// ErrSessionHijackSuspected or a bad one reported with ErrBadCookie has
+// already been replaced, so the request goes on with the new session; other
+// store errors are passed to the error handler and the wrapped handler isn't
+// called.
+func Middleware(store *MariadbStore, name string, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	m := &middleware{
+		store: store,
+		name:  name,
+		onError: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session, err := m.store.Get(r, m.name)
+			if err != nil && !errors.Is(err, ErrSessionHijackSuspected) && !errors.Is(err, ErrBadCookie) {
+				m.onError(w, r, err)
+				return
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), sessionKey{}, session))
+			sw := &sessionWriter{ResponseWriter: w, m: m, r: r, session: session}
+			next.ServeHTTP(sw, r)
+			sw.save()
+		})
+	}
+}
+
+// dirty reports whether the session needs to be saved.
+func (m *middleware) dirty(session *sessions.Session) bool {
+	switch {
+	case session.Options.MaxAge < 0:
+		return true
+	case session.IsNew:
+		// a session replacing an unusable cookie already has a row, and the
+		// client needs its cookie
+		return session.ID != "" || len(session.Values) > 0
+	case m.store.touchOnRead, m.store.skipUnchanged:
+		// Save extends the expiry, or with WithSkipUnchanged decides
+		// whether it's due
+		return true
+	}
+	return modified(session)
+}
+
+// sessionWriter saves the session before the response is written, while the
+// cookie can still be set.
+type sessionWriter struct {
+	http.ResponseWriter
+	m       *middleware
+	r       *http.Request
+	session *sessions.Session
+	// saved is set once the session has been saved, after which it is only
+	// saved again if the handler changes it.
+	saved bool
+	// failed discards the handler's response after the error handler has
+	// responded.
+	failed bool
+}
+
+func (w *sessionWriter) save() {
+	if w.failed {
+		return
+	}
+	if w.saved && !modified(w.session) || !w.saved && !w.m.dirty(w.session) {
+		return
+	}
+	w.saved = true
+	if err := w.session.Save(w.r, w.ResponseWriter); err != nil && !errors.Is(err, ErrSessionVanished) {
+		w.failed = true
+		w.m.onError(w.ResponseWriter, w.r, err)
+	}
+}
+
+func (w *sessionWriter) WriteHeader(code int) {
+	w.save()
+	if !w.failed {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.save()
+	if w.failed {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush saves the session before the first flush sends the headers.
+func (w *sessionWriter) Flush() {
+	w.save()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && !w.failed {
+		f.Flush()
+	}
+}
+
+// Hijack saves the session before the handler takes over the connection.
+func (w *sessionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.save()
+	if w.failed {
+		return nil, nil, errors.New("session couldn't be saved")
+	}
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return h.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
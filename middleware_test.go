@@ -0,0 +1,86 @@
+package mariadbstore
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve runs r through Middleware with a handler calling f with the
+// session.
+func serve(s *MariadbStore, r *http.Request, f func(values map[interface{}]interface{})) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	Middleware(s, "session")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f != nil {
+			f(FromContext(r.Context()).Values)
+		}
+		w.Write([]byte("ok"))
+	})).ServeHTTP(w, r)
+	return w
+}
+
+func writes(db *fakeDB) []string {
+	var queries []string
+	for _, prefix := range []string{"INSERT", "UPDATE", "DELETE"} {
+		q, _ := db.ran(prefix)
+		queries = append(queries, q...)
+	}
+	return queries
+}
+
+func TestMiddlewareSavesChanges(t *testing.T) {
+	s, db := newFakeStore(t)
+	w := serve(s, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	if queries := writes(db); len(queries) != 0 || w.Header().Get("Set-Cookie") != "" {
+		t.Errorf("empty new session was stored: %q", queries)
+	}
+
+	db.setHandler(func(query string, args []driver.Value) (fakeResult, error) {
+		return fakeResult{lastInsertID: 7, rowsAffected: 1}, nil
+	})
+	w = serve(s, httptest.NewRequest(http.MethodGet, "/", nil), func(values map[interface{}]interface{}) {
+		values["user"] = "alice"
+	})
+	if queries, _ := db.ran("INSERT INTO `sessions`.`sessions`"); len(queries) != 1 {
+		t.Errorf("changed new session was inserted %d times, want once", len(queries))
+	}
+	if !strings.HasPrefix(w.Header().Get("Set-Cookie"), "session=") || w.Body.String() != "ok" {
+		t.Errorf("response has cookie %q and body %q", w.Header().Get("Set-Cookie"), w.Body)
+	}
+}
+
+func TestMiddlewareSkipsUnchanged(t *testing.T) {
+	values := map[interface{}]interface{}{"user": "alice"}
+	lifetime := time.Duration(30*86400) * time.Second
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		expires time.Time
+		change  bool
+		written bool
+	}{
+		{"unchanged", nil, time.Now().Add(time.Hour), false, false},
+		{"changed", nil, time.Now().Add(time.Hour), true, true},
+		{"touch on read", []Option{WithTouchOnRead()}, time.Now().Add(lifetime), false, true},
+		{"skip unchanged, fresh", []Option{WithSkipUnchanged()}, time.Now().Add(lifetime - time.Hour), false, false},
+		{"skip unchanged, due", []Option{WithSkipUnchanged()}, time.Now().Add(time.Hour), false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newFakeStore(t, tt.opts...)
+			serveRow(t, s, db, values, tt.expires)
+			serve(s, requestWithSession(t, s, "session", "5"), func(values map[interface{}]interface{}) {
+				if tt.change {
+					values["user"] = "bob"
+				}
+			})
+			if queries := writes(db); len(queries) > 0 != tt.written {
+				t.Errorf("session written with %q, want written %v", queries, tt.written)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package mariadbstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const migrationLockTimeout = time.Minute
+
+// migration is one step in the evolution of the sessions table. Steps must
+// be idempotent because stores that don't track versions apply all of them
+// on startup.
+type migration struct {
+	version     int
+	description string
+	up          func(ctx context.Context, s *MariadbStore) error
+}
+
+// statements returns a migration step that runs the given statements in order.
+func statements(queries ...string) func(context.Context, *MariadbStore) error {
+	return func(ctx context.Context, s *MariadbStore) error {
+		for _, query := range queries {
+			if _, err := s.db.ExecContext(ctx, s.sql(query)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// migrations lists every schema change in the order it was introduced. New
+// steps must only ever be appended.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create sessions table",
+		up: func(ctx context.Context, s *MariadbStore) error {
+			return s.createTable(ctx)
+		},
+	},
+	{
+		version:     2,
+		description: "add name and created_at columns",
+		up: statements(`
+			ALTER TABLE {table}
+				ADD COLUMN IF NOT EXISTS {name} VARCHAR(255) NOT NULL DEFAULT '' AFTER {id},
+				ADD COLUMN IF NOT EXISTS {created_at} INT NOT NULL DEFAULT 0 AFTER {name}
+		`),
+	},
+	{
+		version:     3,
+		description: "add last_active column",
+		up: statements(`
+			ALTER TABLE {table}
+				ADD COLUMN IF NOT EXISTS {last_active} INT NOT NULL DEFAULT 0 AFTER {created_at}
+		`),
+	},
+	{
+		version:     4,
+		description: "add updated_at, client_ip and user_agent columns",
+		up: statements(`
+			ALTER TABLE {table}
+				ADD COLUMN IF NOT EXISTS {updated_at} INT NOT NULL DEFAULT 0,
+				ADD COLUMN IF NOT EXISTS {client_ip} VARCHAR(45) NOT NULL DEFAULT '',
+				ADD COLUMN IF NOT EXISTS {user_agent} VARCHAR(512) NOT NULL DEFAULT ''
+		`),
+	},
+	{
+		version:     5,
+		description: "add fingerprint column",
+		up: statements(`
+			ALTER TABLE {table}
+				ADD COLUMN IF NOT EXISTS {fingerprint} VARBINARY(32) NOT NULL DEFAULT ''
+		`),
+	},
+	{
+		version:     6,
+		description: "add user_id column",
+		up: statements(`
+			ALTER TABLE {table}
+				ADD COLUMN IF NOT EXISTS {user_id} VARCHAR(255) NOT NULL DEFAULT '',
+				ADD INDEX IF NOT EXISTS {user_id} ({user_id})
+		`),
+	},
+	{
+		version:     7,
+		description: "add options column",
+		up: statements(`
+			ALTER TABLE {table}
+				ADD COLUMN IF NOT EXISTS {options} VARCHAR(255) NOT NULL DEFAULT ''
+		`),
+	},
+	{
+		version:     8,
+		description: "add deleted_at column",
+		up: statements(`
+			ALTER TABLE {table}
+				ADD COLUMN IF NOT EXISTS {deleted_at} INT NOT NULL DEFAULT 0
+		`),
+	},
+	{
+		version:     9,
+		description: "index expires column",
+		up: statements(`
+			ALTER TABLE {table}
+				ADD INDEX IF NOT EXISTS {expires} ({expires})
+		`),
+	},
+}
+
+// Migrate applies pending schema migrations and records them in the
+// <table>_schema_version table. Instances sharing the table take turns using
+// GET_LOCK so each migration runs once.
+func (s *MariadbStore) Migrate(ctx context.Context) error {
+	if err := checkIdentifier("table", s.versionTable()); err != nil {
+		return err
+	}
+	if err := s.createDatabase(ctx); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, s.sql(`
+		CREATE TABLE IF NOT EXISTS {version_table} (
+			version INT PRIMARY KEY NOT NULL,
+			description VARCHAR(255) NOT NULL,
+			applied_at INT NOT NULL
+		) ENGINE=InnoDB
+	`))
+	if err != nil {
+		return err
+	}
+
+	lockName := defaultLockName("migrate", s.databaseName, s.tableName)
+	conn, err := s.acquireLock(ctx, lockName, migrationLockTimeout)
+	if err != nil {
+		return err
+	}
+	if conn == nil {
+		return fmt.Errorf("timed out waiting for the migration lock %s", lockName)
+	}
+	defer releaseLock(conn, lockName)
+
+	current, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := m.up(ctx, s); err != nil {
+			return fmt.Errorf("schema migration %d (%s): %w", m.version, m.description, err)
+		}
+		_, err := s.db.ExecContext(ctx, s.sql(`INSERT INTO {version_table} SET version=?, description=?, applied_at=?`), m.version, m.description, time.Now().Unix())
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.createOptionalSchema(ctx)
+}
+
+// SchemaVersion returns the latest migration recorded by Migrate, or zero if
+// none has been recorded yet.
+func (s *MariadbStore) SchemaVersion(ctx context.Context) (int, error) {
+	if err := checkIdentifier("table", s.versionTable()); err != nil {
+		return 0, err
+	}
+	var version int
+	err := s.db.QueryRowContext(ctx, s.sql(`SELECT COALESCE(MAX(version), 0) FROM {version_table}`)).Scan(&version)
+	return version, err
+}
@@ -0,0 +1,128 @@
+package mariadbstore
+
+import (
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// namedSession is the configuration registered for a session name.
+type namedSession struct {
+	options sessions.Options
+	codecs  []securecookie.Codec
+	// derived codecs are built from the store's key pairs and follow
+	// SetKeyPairs.
+	derived bool
+}
+
+// RegisterSession sets the default cookie options and codecs of the sessions
+// named name, e.g. a long-lived "remember me" session next to a short-lived
+// one, instead of the store's Options and Codecs. Without codecs the store's
+// key pairs are used, with the MaxAge of opts. It is safe to call while the
+// store serves requests, but SetOptions, MaxAge and MaxLength don't affect
+// registered sessions.
+func (s *MariadbStore) RegisterSession(name string, opts sessions.Options, codecs ...securecookie.Codec) {
+	defer s.eachTenant(func(t *MariadbStore) { t.RegisterSession(name, opts, codecs...) })
+	s.codecsMu.Lock()
+	defer s.codecsMu.Unlock()
+
+	n := &namedSession{options: opts, codecs: codecs, derived: len(codecs) == 0}
+	if n.derived {
+		n.codecs = s.derivedCodecs(opts.MaxAge)
+	} else {
+		for _, c := range codecs {
+			if codec, ok := c.(*securecookie.SecureCookie); ok {
+				codec.MaxAge(opts.MaxAge)
+			}
+		}
+	}
+	if s.named == nil {
+		s.named = make(map[string]*namedSession)
+	}
+	s.named[name] = n
+}
+
+// derivedCodecs returns codecs built from the store's key pairs that accept
+// cookies up to maxAge seconds old, or nil when the key pairs aren't known.
+// It must be called with codecsMu held.
+func (s *MariadbStore) derivedCodecs(maxAge int) []securecookie.Codec {
+	if s.keyPairs == nil {
+		return nil
+	}
+	codecs := securecookie.CodecsFromPairs(s.keyPairs...)
+	for _, c := range codecs {
+		if codec, ok := c.(*securecookie.SecureCookie); ok {
+			codec.MaxAge(maxAge)
+			if s.maxLength >= 0 {
+				codec.MaxLength(s.maxLength)
+			}
+		}
+	}
+	return codecs
+}
+
+// optionsFor returns a copy of the default options of the named sessions.
+func (s *MariadbStore) optionsFor(name string) sessions.Options {
+	s.codecsMu.RLock()
+	defer s.codecsMu.RUnlock()
+	if n, ok := s.named[name]; ok {
+		return n.options
+	}
+	return *s.Options
+}
+
+// timelessCodecs returns codecs built from keyPairs that don't check the age
+// of the values they decode.
+func timelessCodecs(keyPairs [][]byte, maxLength int) []securecookie.Codec {
+	codecs := securecookie.CodecsFromPairs(keyPairs...)
+	for _, c := range codecs {
+		if codec, ok := c.(*securecookie.SecureCookie); ok {
+			codec.MaxAge(0)
+			if maxLength >= 0 {
+				codec.MaxLength(maxLength)
+			}
+		}
+	}
+	return codecs
+}
+
+// rowCodecsFor returns the codecs that decode the ID cookies and stored data
+// of the named sessions. Their age isn't checked because a session's
+// lifetime is enforced by its expires column: data that was only touched
+// keeps the time it was last written, and a MaxAge persisted with
+// WithPersistedOptions or a browser session TTL may outlast the codecs'
+// MaxAge. Sessions with codecs of their own, or a store without key pairs,
+// use the regular codecs.
+func (s *MariadbStore) rowCodecsFor(name string) []securecookie.Codec {
+	s.codecsMu.RLock()
+	defer s.codecsMu.RUnlock()
+	if n, ok := s.named[name]; ok && !n.derived && len(n.codecs) > 0 {
+		return n.codecs
+	}
+	if s.rowCodecs != nil {
+		return s.rowCodecs
+	}
+	return s.Codecs
+}
+
+// codecsFor returns the codecs of the named sessions.
+func (s *MariadbStore) codecsFor(name string) []securecookie.Codec {
+	s.codecsMu.RLock()
+	defer s.codecsMu.RUnlock()
+	if n, ok := s.named[name]; ok && len(n.codecs) > 0 {
+		return n.codecs
+	}
+	return s.Codecs
+}
+
+// longestMaxAge returns the longest default lifetime of any session name.
+func (s *MariadbStore) longestMaxAge() time.Duration {
+	s.codecsMu.RLock()
+	defer s.codecsMu.RUnlock()
+	maxAge := s.Options.MaxAge
+	for _, n := range s.named {
+		maxAge = max(maxAge, n.options.MaxAge)
+	}
+	return time.Duration(maxAge) * time.Second
+}
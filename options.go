@@ -0,0 +1,726 @@
+package mariadbstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures a MariadbStore created with NewMariadbStoreWithOptions.
+type Option func(*MariadbStore) error
+
+// WithKeyPairs sets the securecookie hash and block key pairs used to sign
+// and encrypt the session cookie.
+func WithKeyPairs(keyPairs ...[]byte) Option {
+	return func(s *MariadbStore) error {
+		s.keyPairs = keyPairs
+		s.Codecs = securecookie.CodecsFromPairs(keyPairs...)
+		s.rowCodecs = timelessCodecs(keyPairs, s.maxLength)
+		return nil
+	}
+}
+
+// WithSerializer sets the serializer used to store session values in the
+// database. The default encodes values with the store's securecookie codecs.
+func WithSerializer(serializer Serializer) Option {
+	return func(s *MariadbStore) error {
+		if serializer == nil {
+			return errors.New("serializer cannot be nil")
+		}
+		s.serializer = serializer
+		return nil
+	}
+}
+
+// WithEncryption encrypts session data with AES-GCM before it is written to
+// the database. The keyring is independent of the cookie key pairs.
+func WithEncryption(keyring *Keyring) Option {
+	return func(s *MariadbStore) error {
+		if keyring == nil {
+			return errors.New("keyring cannot be nil")
+		}
+		s.keyring = keyring
+		return nil
+	}
+}
+
+// WithCompression compresses session data of at least threshold bytes
+// before it is encrypted and stored. Stored data is decompressed whatever
+// the setting, so compression can be turned on or off at any time.
+func WithCompression(c Compression, threshold int) Option {
+	return func(s *MariadbStore) error {
+		if c > Zstd {
+			return fmt.Errorf("unknown compression %d", c)
+		}
+		if threshold < 0 {
+			return errors.New("compression threshold cannot be negative")
+		}
+		s.compression = c
+		s.compressMin = threshold
+		return nil
+	}
+}
+
+// WithMaxDataSize limits the serialized size of the session values stored
+// in the database. Saving a larger session fails with ErrSessionTooLarge and
+// leaves the stored session unchanged. Unlike MaxLength, which only limits
+// the cookie, this caps the session_data column.
+func WithMaxDataSize(bytes int) Option {
+	return func(s *MariadbStore) error {
+		if bytes <= 0 {
+			return errors.New("max data size must be positive")
+		}
+		s.maxDataSize = bytes
+		return nil
+	}
+}
+
+// WithSessionMetadata records when each session was last updated and the IP
+// address and User-Agent of the request that last saved it. They are
+// returned by ListSessions. ip extracts the client IP from a request; nil
+// uses RemoteAddrIP, so pass your own function when running behind a proxy.
+func WithSessionMetadata(ip func(*http.Request) string) Option {
+	return func(s *MariadbStore) error {
+		s.metadata = true
+		if ip != nil {
+			s.clientIP = ip
+		}
+		return nil
+	}
+}
+
+// WithSessionBinding stores a hash of the client IP and User-Agent with each
+// session and rejects sessions presented by a different client, returning
+// ErrSessionHijackSuspected from New. The client IP is read with the
+// function passed to WithSessionMetadata, or RemoteAddrIP.
+func WithSessionBinding(policy BindingPolicy) Option {
+	return func(s *MariadbStore) error {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+		if !policy.enabled() {
+			return errors.New("binding policy binds nothing")
+		}
+		s.binding = policy
+		return nil
+	}
+}
+
+// WithMaxSessionsPerUser limits how many live sessions can be associated
+// with a user through SetUserID. When saving a session would exceed n,
+// policy either rejects the save or evicts the user's oldest sessions.
+func WithMaxSessionsPerUser(n int, policy SessionLimitPolicy) Option {
+	return func(s *MariadbStore) error {
+		if n <= 0 {
+			return errors.New("max sessions per user must be positive")
+		}
+		if policy != RejectNewSessions && policy != EvictOldestSessions {
+			return fmt.Errorf("unknown session limit policy %d", policy)
+		}
+		s.maxPerUser = n
+		s.limitPolicy = policy
+		return nil
+	}
+}
+
+// WithHooks calls h when sessions are created, saved, deleted or expired,
+// e.g. to emit audit events or keep other systems in sync.
+func WithHooks(h Hooks) Option {
+	return func(s *MariadbStore) error {
+		s.hooks = h
+		return nil
+	}
+}
+
+// WithAuditLog records session creates, refreshes, deletes and expiries in
+// an audit table in the sessions database, along with the user, IP address
+// and User-Agent when they are known. The table is created with the sessions
+// table. An empty name uses "<table>_audit".
+func WithAuditLog(tableName string) Option {
+	return func(s *MariadbStore) error {
+		if tableName == "" {
+			tableName = s.tableName + "_audit"
+		}
+		s.auditName = tableName
+		return nil
+	}
+}
+
+// WithJSONStorage stores session values as JSON in a JSON data column so
+// they can be queried from SQL, e.g. WHERE session_data->>'$.role' = 'admin'.
+// Values are serialized with JSONSerializer and can't be encrypted or
+// compressed. The column type only applies to newly created tables.
+func WithJSONStorage() Option {
+	return func(s *MariadbStore) error {
+		s.jsonStorage = true
+		return nil
+	}
+}
+
+// WithIndexedField adds an indexed virtual column holding the value at the
+// JSON path, e.g. WithIndexedField("uid", "$.uid"). It requires
+// WithJSONStorage.
+func WithIndexedField(column, path string) Option {
+	return func(s *MariadbStore) error {
+		if !identifierPattern.MatchString(column) {
+			return fmt.Errorf("invalid column name %q", column)
+		}
+		if !jsonPathPattern.MatchString(path) {
+			return fmt.Errorf("invalid JSON path %q", path)
+		}
+		s.indexedFields = append(s.indexedFields, indexedField{column: column, path: path})
+		return nil
+	}
+}
+
+// WithPersistedOptions stores the MaxAge, Secure, SameSite and Partitioned
+// options of sessions that change them, e.g. a longer MaxAge for "remember
+// me", and restores them when the session is loaded. Sessions using the
+// store's options follow later changes to them.
+func WithPersistedOptions() Option {
+	return func(s *MariadbStore) error {
+		s.persistOptions = true
+		return nil
+	}
+}
+
+// WithCookieOptions replaces the default cookie options, which are HttpOnly
+// and SameSite=Lax and add Secure to cookies set over TLS. opts are used as
+// given, so Secure must be set explicitly. Partitioned (CHIPS) cookies and
+// SameSite=None need Secure, which browsers require for them.
+func WithCookieOptions(opts sessions.Options) Option {
+	return func(s *MariadbStore) error {
+		if (opts.Partitioned || opts.SameSite == http.SameSiteNoneMode) && !opts.Secure {
+			return errors.New("partitioned and SameSite=None cookies must be Secure")
+		}
+		s.Options = &opts
+		s.detectTLS = false
+		return nil
+	}
+}
+
+// WithHybridStorage keeps sessions whose encoded values fit in a cookie of
+// at most maxCookieSize bytes entirely in the cookie, like a CookieStore, and
+// only stores larger sessions in the database. Sessions move between the two
+// as they grow and shrink. Cookie sessions have an empty ID and aren't seen
+// by database features such as ListSessions or hooks. Sessions associated
+// with a user through SetUserID are always stored in the database.
+func WithHybridStorage(maxCookieSize int) Option {
+	return func(s *MariadbStore) error {
+		if maxCookieSize <= 0 {
+			return errors.New("max cookie size must be positive")
+		}
+		s.hybridLimit = maxCookieSize
+		return nil
+	}
+}
+
+// WithSoftDelete makes deleting a session mark it as deleted instead of
+// removing it. Deleted sessions can't be loaded but their rows are kept for
+// the grace period, e.g. for support investigations, before the cleanup
+// removes them.
+func WithSoftDelete(grace time.Duration) Option {
+	return func(s *MariadbStore) error {
+		if grace <= 0 {
+			return errors.New("soft delete grace period must be positive")
+		}
+		s.softDelete = grace
+		return nil
+	}
+}
+
+// WithPartitioning creates the sessions table partitioned by expiry, with
+// one partition per size, e.g. 24 * time.Hour. The cleanup drops partitions
+// whose sessions have all expired instead of deleting their rows, creates the
+// partitions for the coming sessions and only deletes the expired sessions in
+// the current partition. It only applies to tables the store creates and
+// can't be combined with OnExpire, the audit log or WithExpiryHandler.
+func WithPartitioning(size time.Duration) Option {
+	return func(s *MariadbStore) error {
+		if size < time.Hour {
+			return errors.New("partition size must be at least an hour")
+		}
+		s.partitionSize = size
+		return nil
+	}
+}
+
+// WithExpiryHandler passes every expired session, with its decoded values,
+// to h before the cleanup deletes it, e.g. to archive it in cold storage. A
+// session h returns an error for is kept and passed to h again by the next
+// cleanup. Expired sessions are then only deleted by the cleanup, even with
+// WithDeleteExpiredOnLoad.
+func WithExpiryHandler(h func(ctx context.Context, session SessionInfo) error) Option {
+	return func(s *MariadbStore) error {
+		if h == nil {
+			return errors.New("expiry handler cannot be nil")
+		}
+		s.expiryHandler = h
+		return nil
+	}
+}
+
+// WithGaleraMode adapts the store to Galera and other multi-master clusters.
+// Session IDs are random strings generated by the store instead of
+// AUTO_INCREMENT values, converting the ID column of an existing table, and
+// inserts are written as upserts, so they can be retried after a
+// certification conflict. Writes are retried three times unless WithRetry
+// sets another policy.
+func WithGaleraMode() Option {
+	return func(s *MariadbStore) error {
+		s.galera = true
+		if s.retry.MaxAttempts == 0 {
+			s.retry = RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 200 * time.Millisecond}
+		}
+		return nil
+	}
+}
+
+// WithIDGenerator generates the IDs of new sessions with gen instead of
+// using AUTO_INCREMENT values. The ID column of an existing table is
+// converted to a string column; existing sessions keep their numeric IDs.
+// Inserting an ID that is already in use fails, except in Galera mode, which
+// relies on gen never repeating an ID.
+func WithIDGenerator(gen IDGenerator) Option {
+	return func(s *MariadbStore) error {
+		if gen == nil {
+			return errors.New("ID generator cannot be nil")
+		}
+		s.idGenerator = gen
+		return nil
+	}
+}
+
+// WithBadCookiePolicy sets how New handles cookies and stored sessions that
+// can't be decoded, e.g. after a key change. By default they are silently
+// replaced with a new session.
+func WithBadCookiePolicy(policy BadCookiePolicy) Option {
+	return func(s *MariadbStore) error {
+		s.badCookie = policy
+		return nil
+	}
+}
+
+// WithTenantFunc isolates the sessions of each tenant in a table of its own,
+// named "<table>_<tenant>", which is created with the store's options the
+// first time the tenant is seen. f returns the tenant of a request, or an
+// empty string for the store's own table; it must only return known tenants,
+// never unchecked request input. Each tenant's table is cleaned up by its
+// own store, which Tenant returns for per-tenant stats and administration.
+func WithTenantFunc(f func(r *http.Request) string) Option {
+	return func(s *MariadbStore) error {
+		if f == nil {
+			return errors.New("tenant func cannot be nil")
+		}
+		s.tenants = &tenants{
+			resolve: f,
+			stores:  make(map[string]*MariadbStore),
+			pending: make(map[string]*tenantInit),
+		}
+		return nil
+	}
+}
+
+// WithMaxTenants sets how many tenant stores WithTenantFunc creates, 100 by
+// default. Tenant returns an error for new tenants once the limit is
+// reached. Every tenant store prepares its own statements, about 20 of them
+// on each connection of the pool, and MariaDB refuses to prepare more than
+// max_prepared_stmt_count statements across all connections.
+func WithMaxTenants(n int) Option {
+	return func(s *MariadbStore) error {
+		if n < 1 {
+			return errors.New("max tenants must be at least 1")
+		}
+		s.maxTenants = n
+		return nil
+	}
+}
+
+// WithFailurePolicy sets how New and Save behave while the database is
+// unreachable. The default is FailClosed.
+func WithFailurePolicy(policy FailurePolicy) Option {
+	return func(s *MariadbStore) error {
+		if policy < FailClosed || policy > FailToCookie {
+			return fmt.Errorf("unknown failure policy %d", policy)
+		}
+		s.failurePolicy = policy
+		return nil
+	}
+}
+
+// WithCircuitBreaker stops querying the database for cooldown after failures
+// consecutive loads or saves failed with ErrStoreUnavailable. Meanwhile New
+// and Save fail right away, or degrade according to WithFailurePolicy. After
+// the cooldown a single request probes the database, while the others keep
+// failing fast until it succeeds.
+func WithCircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(s *MariadbStore) error {
+		if failures < 1 || cooldown <= 0 {
+			return errors.New("circuit breaker needs at least one failure and a positive cooldown")
+		}
+		s.breaker = &breaker{threshold: failures, cooldown: cooldown}
+		return nil
+	}
+}
+
+// WithWriteBehind holds back the expiry refreshes of sessions whose values
+// didn't change, made with WithTouchOnRead, and writes them every interval,
+// or once maxSessions sessions are waiting, in a single UPDATE per batch.
+// Loading a refreshed session on another instance before the write shows its
+// previous expiry, and refreshes not yet written when the process crashes
+// are lost, so sessions may expire up to interval earlier than they would
+// otherwise. Saves that change values are still written immediately. Close
+// and Flush write the pending refreshes.
+func WithWriteBehind(interval time.Duration, maxSessions int) Option {
+	return func(s *MariadbStore) error {
+		if interval <= 0 {
+			return errors.New("write-behind interval must be positive")
+		}
+		if maxSessions < 1 || maxSessions > maxWriteBehindBatch {
+			return fmt.Errorf("write-behind batch size must be between 1 and %d", maxWriteBehindBatch)
+		}
+		s.behind = newWriteBehind(interval, maxSessions)
+		return nil
+	}
+}
+
+// WithLazyPersist defers writing a new session to the database until it is
+// saved with at least one value. Empty sessions are never stored and don't
+// get a cookie, so anonymous traffic doesn't create rows.
+func WithLazyPersist() Option {
+	return func(s *MariadbStore) error {
+		s.lazyPersist = true
+		return nil
+	}
+}
+
+// WithSkipUnchanged makes Save write nothing, and not set the cookie again,
+// when the values, user and cookie options of a stored session haven't
+// changed since it was loaded. Its expiry is extended once less than half of
+// its lifetime is left, so read-mostly requests rarely write.
+func WithSkipUnchanged() Option {
+	return func(s *MariadbStore) error {
+		s.skipUnchanged = true
+		return nil
+	}
+}
+
+// WithTouchOnRead makes Save only extend the expiry of sessions whose values
+// haven't changed since they were loaded, instead of rewriting the data.
+func WithTouchOnRead() Option {
+	return func(s *MariadbStore) error {
+		s.touchOnRead = true
+		return nil
+	}
+}
+
+// WithExpirationPolicy sets a sliding idle timeout and an absolute maximum
+// lifetime for stored sessions, e.g. 30 minutes idle and 12 hours absolute.
+func WithExpirationPolicy(policy ExpirationPolicy) Option {
+	return func(s *MariadbStore) error {
+		if policy.IdleTimeout < 0 || policy.AbsoluteTimeout < 0 {
+			return errors.New("expiration timeouts cannot be negative")
+		}
+		s.expiration = policy
+		return nil
+	}
+}
+
+// WithBrowserSessionTTL sets how long the row of a session with MaxAge 0 is
+// kept after it was last saved. Such sessions get a cookie without an
+// expiry, which lasts until the browser is closed. The default is 24 hours.
+func WithBrowserSessionTTL(d time.Duration) Option {
+	return func(s *MariadbStore) error {
+		if d <= 0 {
+			return errors.New("browser session ttl must be positive")
+		}
+		s.browserTTL = d
+		return nil
+	}
+}
+
+// WithCleanupInterval sets how often expired sessions are deleted by the
+// background goroutine. The default is every 24 hours.
+func WithCleanupInterval(d time.Duration) Option {
+	return func(s *MariadbStore) error {
+		if d <= 0 {
+			return errors.New("cleanup interval must be positive")
+		}
+		s.cleanupInterval = d
+		return nil
+	}
+}
+
+// WithoutCleanup disables the background cleanup goroutine. Call CleanExpired
+// to delete expired sessions, e.g. from a cron job.
+func WithoutCleanup() Option {
+	return func(s *MariadbStore) error {
+		s.cleanupInterval = 0
+		return nil
+	}
+}
+
+// WithCleanupTimeout bounds each run of CleanExpired, including the
+// background cleanup, so a slow purge of a large table can't hold its locks
+// indefinitely. A run that times out fails and is picked up by the next one.
+func WithCleanupTimeout(d time.Duration) Option {
+	return func(s *MariadbStore) error {
+		if d <= 0 {
+			return errors.New("cleanup timeout must be positive")
+		}
+		s.cleanupTimeout = d
+		return nil
+	}
+}
+
+// WithCleanupErrorHandler calls h with the error of every failed background
+// cleanup, e.g. to alert when purges stop working after a permissions
+// change. It isn't called for CleanExpired calls made by the application.
+func WithCleanupErrorHandler(h func(ctx context.Context, err error)) Option {
+	return func(s *MariadbStore) error {
+		if h == nil {
+			return errors.New("cleanup error handler cannot be nil")
+		}
+		s.cleanupErrors = h
+		return nil
+	}
+}
+
+// WithAsyncStartupCleanup runs the first cleanup in the background instead
+// of before the constructor returns, so starting an instance doesn't wait for
+// the purge of a large table.
+func WithAsyncStartupCleanup() Option {
+	return func(s *MariadbStore) error {
+		s.asyncStartup = true
+		return nil
+	}
+}
+
+// WithDatabaseCleanup creates a MariaDB EVENT that purges expired sessions
+// every interval instead of running the cleanup goroutine, so sessions are
+// purged even while no instance of the application is running. The event is
+// created with the schema, or by Migrate and EnsureSchema, and requires the
+// EVENT privilege and the server's event_scheduler. It can't be combined with
+// partitioning or anything that reports each expired session.
+func WithDatabaseCleanup(interval time.Duration) Option {
+	return func(s *MariadbStore) error {
+		if interval < time.Second {
+			return errors.New("database cleanup interval must be at least a second")
+		}
+		s.dbCleanup = interval
+		return nil
+	}
+}
+
+// WithDistributedCleanup coordinates the background cleanup between store
+// instances sharing a table. The instances elect a leader with GET_LOCK and
+// only the leader purges expired sessions. An empty lock name derives one
+// from the database and table names.
+func WithDistributedCleanup(lockName string) Option {
+	return func(s *MariadbStore) error {
+		if len(lockName) > maxLockNameLength {
+			return fmt.Errorf("lock name cannot be longer than %d characters", maxLockNameLength)
+		}
+		if lockName == "" {
+			lockName = defaultLockName("cleanup", s.databaseName, s.tableName)
+		}
+		s.cleanupLock = lockName
+		return nil
+	}
+}
+
+// WithMetrics reports store activity to m.
+func WithMetrics(m Metrics) Option {
+	return func(s *MariadbStore) error {
+		if m == nil {
+			return errors.New("metrics cannot be nil")
+		}
+		s.metrics = m
+		return nil
+	}
+}
+
+// WithTracerProvider emits OpenTelemetry spans for store operations using
+// the given provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(s *MariadbStore) error {
+		if tp == nil {
+			return errors.New("tracer provider cannot be nil")
+		}
+		s.tracer = tp.Tracer(tracerName)
+		return nil
+	}
+}
+
+// WithLogger logs cleanup failures, decode failures and query errors to l.
+func WithLogger(l Logger) Option {
+	return func(s *MariadbStore) error {
+		if l == nil {
+			return errors.New("logger cannot be nil")
+		}
+		s.logger = l
+		return nil
+	}
+}
+
+// WithLogLevels overrides the levels store events are logged at.
+func WithLogLevels(levels LogLevels) Option {
+	return func(s *MariadbStore) error {
+		s.logLevels = levels
+		return nil
+	}
+}
+
+// WithDeleteExpiredOnLoad deletes an expired session as soon as a request
+// tries to load it instead of leaving it for the next cleanup run.
+func WithDeleteExpiredOnLoad() Option {
+	return func(s *MariadbStore) error {
+		s.deleteExpired = true
+		return nil
+	}
+}
+
+// WithColumns overrides the column names of the sessions table.
+func WithColumns(columns Columns) Option {
+	return func(s *MariadbStore) error {
+		s.columns = columns.withDefaults()
+		return nil
+	}
+}
+
+// WithEngine sets the storage engine used when creating the table. The
+// default is InnoDB.
+func WithEngine(engine string) Option {
+	return func(s *MariadbStore) error {
+		if err := checkName("engine", engine); err != nil {
+			return err
+		}
+		s.engine = engine
+		return nil
+	}
+}
+
+// WithCharset sets the default character set and collation of the table.
+// Empty values use the database defaults.
+func WithCharset(charset, collation string) Option {
+	return func(s *MariadbStore) error {
+		if charset != "" {
+			if err := checkName("charset", charset); err != nil {
+				return err
+			}
+		}
+		if collation != "" {
+			if err := checkName("collation", collation); err != nil {
+				return err
+			}
+		}
+		s.charset = charset
+		s.collation = collation
+		return nil
+	}
+}
+
+// WithTableOptions appends extra clauses to the CREATE TABLE statement, e.g.
+// "ROW_FORMAT=COMPRESSED" or a PARTITION BY clause.
+func WithTableOptions(options string) Option {
+	return func(s *MariadbStore) error {
+		s.tableOptions = options
+		return nil
+	}
+}
+
+// WithSchemaTemplate replaces the CREATE TABLE statement with a text/template
+// executed with SchemaTemplateData. The statement should use IF NOT EXISTS
+// and define every column in Columns.
+func WithSchemaTemplate(tmpl string) Option {
+	return func(s *MariadbStore) error {
+		t, err := template.New("schema").Parse(tmpl)
+		if err != nil {
+			return err
+		}
+		s.schemaTemplate = t
+		return nil
+	}
+}
+
+// WithSkipSchemaCreation assumes the database and table already exist, e.g.
+// when the store's credentials lack CREATE privileges. The table is checked
+// with a cheap SELECT instead. Use EnsureSchema to create it separately.
+func WithSkipSchemaCreation() Option {
+	return func(s *MariadbStore) error {
+		s.skipSchema = true
+		return nil
+	}
+}
+
+// WithAutoMigrate runs Migrate when the store is created instead of only
+// creating missing tables and columns.
+func WithAutoMigrate() Option {
+	return func(s *MariadbStore) error {
+		s.autoMigrate = true
+		return nil
+	}
+}
+
+// WithCache keeps up to maxEntries recently used sessions in memory for at
+// most ttl, saving a SELECT for hot sessions. Saves and deletes made through
+// this store update the cache, but changes made by other instances can take
+// up to ttl to be seen.
+func WithCache(maxEntries int, ttl time.Duration) Option {
+	return func(s *MariadbStore) error {
+		if maxEntries <= 0 || ttl <= 0 {
+			return errors.New("cache size and ttl must be positive")
+		}
+		s.cache = newRowCache(maxEntries, ttl)
+		return nil
+	}
+}
+
+// WithReadDB sends session loads, ListSessions and Count to a read replica.
+// Writes always go to the primary database, which is also used whenever the
+// replica fails or hasn't caught up with a session yet.
+func WithReadDB(db DB) Option {
+	return func(s *MariadbStore) error {
+		if isNil(db) {
+			return errors.New("read db cannot be nil")
+		}
+		s.readDB = db
+		return nil
+	}
+}
+
+// WithQueryTimeout bounds every query that loads, saves or deletes a
+// session, independently of the request context. Cleanup queries are bounded
+// by WithCleanupTimeout instead.
+func WithQueryTimeout(d time.Duration) Option {
+	return func(s *MariadbStore) error {
+		if d <= 0 {
+			return errors.New("query timeout must be positive")
+		}
+		s.queryTimeout = d
+		return nil
+	}
+}
+
+// WithRetry retries inserts, updates and deletes that fail with a deadlock,
+// a lock wait timeout or a dropped connection, backing off exponentially
+// between attempts.
+func WithRetry(policy RetryPolicy) Option {
+	return func(s *MariadbStore) error {
+		if policy.MaxAttempts < 1 {
+			return errors.New("retry attempts must be at least 1")
+		}
+		if policy.InitialBackoff < 0 || policy.MaxBackoff < 0 {
+			return errors.New("retry backoff cannot be negative")
+		}
+		s.retry = policy
+		return nil
+	}
+}
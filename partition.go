@@ -0,0 +1,172 @@
+package mariadbstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPartition holds sessions expiring after the last range partition.
+const maxPartition = "pmax"
+
+// partitionBound is a range partition holding sessions that expire before
+// bound.
+type partitionBound struct {
+	name  string
+	bound int64
+}
+
+func (s *MariadbStore) checkPartitioning() error {
+	if s.partitionSize <= 0 {
+		return nil
+	}
+	if s.reportsExpiry() {
+		return errors.New("partitioning can't be combined with OnExpire, the audit log or an expiry handler")
+	}
+	return nil
+}
+
+// partitionHorizon is how far ahead partitions are created, so new sessions
+// rarely land in the catch-all partition.
+func (s *MariadbStore) partitionHorizon() time.Duration {
+	horizon := max(s.longestMaxAge(), s.browserTTL)
+	return horizon + 2*s.partitionSize
+}
+
+// partitionBounds returns the bounds of the partitions needed after last, or
+// after the current partition, to cover the horizon.
+func (s *MariadbStore) partitionBounds(last int64, now time.Time) []int64 {
+	size := int64(s.partitionSize / time.Second)
+	until := now.Add(s.partitionHorizon()).Unix()
+	if start := now.Unix() - now.Unix()%size; last < start {
+		last = start
+	}
+
+	var bounds []int64
+	for bound := last + size; bound-size < until; bound += size {
+		bounds = append(bounds, bound)
+	}
+	return bounds
+}
+
+func partitionList(bounds []int64) string {
+	parts := make([]string, 0, len(bounds)+1)
+	for _, bound := range bounds {
+		parts = append(parts, fmt.Sprintf("PARTITION %s VALUES LESS THAN (%d)", quoteIdentifier(fmt.Sprintf("p%d", bound)), bound))
+	}
+	parts = append(parts, "PARTITION "+quoteIdentifier(maxPartition)+" VALUES LESS THAN MAXVALUE")
+	return strings.Join(parts, ", ")
+}
+
+// partitionNames quotes the names of partitions to list them in a statement.
+// Names read from information_schema may hold any character.
+func partitionNames(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// partitioning returns the PARTITION BY clause of a new sessions table.
+func (s *MariadbStore) partitioning() string {
+	if s.partitionSize <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("PARTITION BY RANGE (%s) (%s)", quoteIdentifier(s.columns.Expires), partitionList(s.partitionBounds(0, time.Now())))
+}
+
+// partitions lists the range partitions of the sessions table in order. It
+// returns none if the table isn't partitioned.
+func (s *MariadbStore) partitions(ctx context.Context) ([]partitionBound, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT PARTITION_NAME, PARTITION_DESCRIPTION FROM information_schema.PARTITIONS
+		WHERE TABLE_SCHEMA=? AND TABLE_NAME=? AND PARTITION_NAME IS NOT NULL AND PARTITION_DESCRIPTION <> 'MAXVALUE'
+		ORDER BY PARTITION_ORDINAL_POSITION`, s.databaseName, s.tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var parts []partitionBound
+	for rows.Next() {
+		var p partitionBound
+		var bound string
+		if err := rows.Scan(&p.name, &bound); err != nil {
+			return nil, err
+		}
+		if p.bound, err = strconv.ParseInt(bound, 10, 64); err != nil {
+			return nil, fmt.Errorf("partition %s: %w", p.name, err)
+		}
+		parts = append(parts, p)
+	}
+	return parts, rows.Err()
+}
+
+// holdsDeleted reports whether a partition holds sessions soft deleted within
+// the grace period, which are kept until purgeDeleted removes them.
+func (s *MariadbStore) holdsDeleted(ctx context.Context, partition string, now time.Time) (bool, error) {
+	if s.softDelete <= 0 {
+		return false, nil
+	}
+	var one int
+	err := s.db.QueryRowContext(ctx, s.sql(`SELECT 1 FROM {table} PARTITION (`+quoteIdentifier(partition)+`) WHERE {deleted_at} >= ? LIMIT 1`), now.Add(-s.softDelete).Unix()).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// cleanPartitions drops the partitions whose sessions have all expired and
+// creates the partitions for the coming sessions. Partitions still holding
+// sessions soft deleted within the grace period are kept. The expired
+// sessions left in the current partition are deleted by the regular cleanup.
+func (s *MariadbStore) cleanPartitions(ctx context.Context, now time.Time) (int64, error) {
+	parts, err := s.partitions(ctx)
+	if err != nil {
+		return 0, s.dbError(ctx, "cleanup", "", err)
+	}
+	// the table was created before partitioning was enabled
+	if len(parts) == 0 {
+		return 0, nil
+	}
+
+	var expired []string
+	for _, p := range parts {
+		if p.bound > now.Unix() {
+			break
+		}
+		held, err := s.holdsDeleted(ctx, p.name, now)
+		if err != nil {
+			return 0, s.dbError(ctx, "cleanup", "", err)
+		}
+		if !held {
+			expired = append(expired, p.name)
+		}
+	}
+	// the last partition is kept so the table stays partitioned
+	if len(expired) == len(parts) {
+		expired = expired[:len(expired)-1]
+	}
+
+	var purged int64
+	if len(expired) > 0 {
+		err := s.db.QueryRowContext(ctx, s.sql(`SELECT COUNT(*) FROM {table} PARTITION (`+partitionNames(expired)+`)`)).Scan(&purged)
+		if err != nil {
+			return 0, s.dbError(ctx, "cleanup", "", err)
+		}
+		if _, err := s.db.ExecContext(ctx, s.sql(`ALTER TABLE {table} DROP PARTITION `+partitionNames(expired))); err != nil {
+			return 0, s.dbError(ctx, "cleanup", "", err)
+		}
+	}
+
+	if bounds := s.partitionBounds(parts[len(parts)-1].bound, now); len(bounds) > 0 {
+		if _, err := s.db.ExecContext(ctx, s.sql(`ALTER TABLE {table} REORGANIZE PARTITION `+quoteIdentifier(maxPartition)+` INTO (`+partitionList(bounds)+`)`)); err != nil {
+			return purged, s.dbError(ctx, "cleanup", "", err)
+		}
+	}
+	return purged, nil
+}
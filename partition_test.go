@@ -0,0 +1,77 @@
+package mariadbstore
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestPartitionBounds(t *testing.T) {
+	const day = 86400
+	s := &MariadbStore{
+		partitionSize: 24 * time.Hour,
+		browserTTL:    time.Hour,
+		Options:       &sessions.Options{MaxAge: day},
+	}
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	start := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC).Unix()
+
+	// the horizon is the session lifetime and two partitions, until the
+	// 13th at noon
+	want := []int64{start + day, start + 2*day, start + 3*day, start + 4*day}
+	if got := s.partitionBounds(0, now); !slices.Equal(got, want) {
+		t.Errorf("partitionBounds(0) = %v, want %v", got, want)
+	}
+	if got := s.partitionBounds(start+2*day, now); !slices.Equal(got, want[2:]) {
+		t.Errorf("partitionBounds after the 12th = %v, want %v", got, want[2:])
+	}
+	if got := s.partitionBounds(start+4*day, now); len(got) != 0 {
+		t.Errorf("partitionBounds after the horizon = %v, want none", got)
+	}
+}
+
+func TestPartitionBoundsCoverHorizon(t *testing.T) {
+	s := &MariadbStore{
+		partitionSize: 6 * time.Hour,
+		browserTTL:    24 * time.Hour,
+		Options:       &sessions.Options{MaxAge: 3600},
+		named:         map[string]*namedSession{"remember": {options: sessions.Options{MaxAge: 7 * 86400}}},
+	}
+	size := int64(6 * 3600)
+	now := time.Date(2026, 3, 1, 7, 30, 0, 0, time.UTC)
+	bounds := s.partitionBounds(0, now)
+	if len(bounds) == 0 {
+		t.Fatal("no partitions")
+	}
+	for i, bound := range bounds {
+		if bound%size != 0 {
+			t.Errorf("bound %d isn't aligned to the partition size", bound)
+		}
+		if i > 0 && bound != bounds[i-1]+size {
+			t.Errorf("bounds %d and %d aren't one partition apart", bounds[i-1], bound)
+		}
+	}
+	if first := bounds[0]; first <= now.Unix() || first-size > now.Unix() {
+		t.Errorf("first bound %d doesn't hold the current time %d", first, now.Unix())
+	}
+	// the longest lifetime comes from the named session
+	if until := now.Add(7*24*time.Hour + 2*s.partitionSize).Unix(); bounds[len(bounds)-1] < until {
+		t.Errorf("last bound %d is before the horizon %d", bounds[len(bounds)-1], until)
+	}
+}
+
+func TestPartitionList(t *testing.T) {
+	want := "PARTITION `p100` VALUES LESS THAN (100), PARTITION `p200` VALUES LESS THAN (200), PARTITION `pmax` VALUES LESS THAN MAXVALUE"
+	if got := partitionList([]int64{100, 200}); got != want {
+		t.Errorf("partitionList = %q, want %q", got, want)
+	}
+}
+
+func TestPartitionNames(t *testing.T) {
+	want := "`p100`, `p-1`, `p``x`"
+	if got := partitionNames([]string{"p100", "p-1", "p`x"}); got != want {
+		t.Errorf("partitionNames = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,52 @@
+package mariadbstore
+
+import (
+	"context"
+	"database/sql"
+)
+
+// prepareReplica prepares the read statements on the read replica.
+func (s *MariadbStore) prepareReplica() error {
+	var err error
+	s.readSelectStmt, err = s.prepareOn(s.readDB, s.queries[s.selectStmt])
+	if err != nil {
+		return err
+	}
+
+	s.readListStmt, err = s.prepareOn(s.readDB, s.queries[s.listStmt])
+	if err != nil {
+		return err
+	}
+
+	s.readCountStmt, err = s.prepareOn(s.readDB, s.queries[s.countStmt])
+	return err
+}
+
+// readRow scans a single row from the replica statement, falling back to the
+// primary when there is no replica, the replica fails, or it doesn't have the
+// row yet because of replication lag.
+func (s *MariadbStore) readRow(ctx context.Context, replica, primary *sql.Stmt, dest []any, args ...any) error {
+	if replica != nil {
+		err := s.scanStmt(ctx, replica, dest, args...)
+		if err == nil {
+			return nil
+		}
+		if err != sql.ErrNoRows {
+			s.log(ctx, s.logLevels.DB, "session replica query failed, using primary", "error", err)
+		}
+	}
+	return s.scanStmt(ctx, primary, dest, args...)
+}
+
+// readRows runs a query on the replica, falling back to the primary when there
+// is no replica or the replica fails.
+func (s *MariadbStore) readRows(ctx context.Context, replica, primary *sql.Stmt, args ...any) (*sql.Rows, error) {
+	if replica != nil {
+		rows, err := s.queryStmt(ctx, replica, args...)
+		if err == nil {
+			return rows, nil
+		}
+		s.log(ctx, s.logLevels.DB, "session replica query failed, using primary", "error", err)
+	}
+	return s.queryStmt(ctx, primary, args...)
+}
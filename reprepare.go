@@ -0,0 +1,142 @@
+package mariadbstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MariaDB error numbers for prepared statements the server no longer
+// accepts, e.g. after the table was altered.
+const (
+	errUnknownStmtHandler = 1243
+	errNeedReprepare      = 1615
+)
+
+func needsReprepare(err error) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == errNeedReprepare || myErr.Number == errUnknownStmtHandler
+	}
+	return false
+}
+
+// current returns the statement that replaced stmt after the server
+// rejected it, or stmt itself.
+func (s *MariadbStore) current(stmt *sql.Stmt) *sql.Stmt {
+	s.repreparedMu.RLock()
+	defer s.repreparedMu.RUnlock()
+	if fresh, ok := s.reprepared[stmt]; ok {
+		return fresh
+	}
+	return stmt
+}
+
+// reprepare prepares the query of stmt again after the server rejected
+// failed, the statement that was used for stmt, and uses the new statement
+// for stmt from then on. database/sql prepares statements again on new
+// connections but not on connections whose statements were invalidated, so
+// failed would keep failing. It is closed with the store, since other calls
+// may still be using it.
+func (s *MariadbStore) reprepare(ctx context.Context, stmt, failed *sql.Stmt, err error) (*sql.Stmt, error) {
+	if prepared := s.current(stmt); prepared != failed {
+		// another call prepared it already
+		return prepared, nil
+	}
+
+	s.log(ctx, s.logLevels.DB, "session store statement needs to be prepared again", "error", err)
+	fresh, err := s.stmtDBs[stmt].PrepareContext(ctx, s.queries[stmt])
+	if err != nil {
+		return nil, err
+	}
+
+	s.repreparedMu.Lock()
+	defer s.repreparedMu.Unlock()
+	if prepared, ok := s.reprepared[stmt]; ok && prepared != failed {
+		fresh.Close()
+		return prepared, nil
+	}
+	if failed != stmt {
+		s.retired = append(s.retired, failed)
+	}
+	s.reprepared[stmt] = fresh
+	return fresh, nil
+}
+
+// closeReprepared closes the statements prepared by reprepare.
+func (s *MariadbStore) closeReprepared() {
+	s.repreparedMu.Lock()
+	defer s.repreparedMu.Unlock()
+	for _, stmt := range s.reprepared {
+		stmt.Close()
+	}
+	for _, stmt := range s.retired {
+		stmt.Close()
+	}
+}
+
+// execStmt runs a prepared statement, through the transaction in ctx if there
+// is one, within the query timeout. A statement the server rejects is
+// prepared again, or run unprepared in a transaction, since preparing it on
+// the pool could wait for the transaction's own connection.
+func (s *MariadbStore) execStmt(ctx context.Context, stmt *sql.Stmt, args ...any) (sql.Result, error) {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+	prepared := s.current(stmt)
+	res, err := s.stmt(ctx, prepared).ExecContext(ctx, args...)
+	if needsReprepare(err) {
+		if scope, ok := txFrom(ctx); ok {
+			return scope.tx.ExecContext(ctx, s.queries[stmt], args...)
+		}
+		if prepared, err = s.reprepare(ctx, stmt, prepared, err); err != nil {
+			return nil, err
+		}
+		return prepared.ExecContext(ctx, args...)
+	}
+	return res, err
+}
+
+// execQuery is execStmt for statements built for a single call, which aren't
+// prepared.
+func (s *MariadbStore) execQuery(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+	return s.db.ExecContext(ctx, s.sql(query), args...)
+}
+
+// queryStmt is execStmt for statements returning rows. The rows outlive the
+// call, so they aren't bounded by the query timeout.
+func (s *MariadbStore) queryStmt(ctx context.Context, stmt *sql.Stmt, args ...any) (*sql.Rows, error) {
+	prepared := s.current(stmt)
+	rows, err := s.stmt(ctx, prepared).QueryContext(ctx, args...)
+	if needsReprepare(err) {
+		if scope, ok := txFrom(ctx); ok {
+			return scope.tx.QueryContext(ctx, s.queries[stmt], args...)
+		}
+		if prepared, err = s.reprepare(ctx, stmt, prepared, err); err != nil {
+			return nil, err
+		}
+		return prepared.QueryContext(ctx, args...)
+	}
+	return rows, err
+}
+
+// scanStmt is execStmt for statements returning a single row.
+func (s *MariadbStore) scanStmt(ctx context.Context, stmt *sql.Stmt, dest []any, args ...any) error {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+	prepared := s.current(stmt)
+	err := s.stmt(ctx, prepared).QueryRowContext(ctx, args...).Scan(dest...)
+	if needsReprepare(err) {
+		if scope, ok := txFrom(ctx); ok {
+			return scope.tx.QueryRowContext(ctx, s.queries[stmt], args...).Scan(dest...)
+		}
+		if prepared, err = s.reprepare(ctx, stmt, prepared, err); err != nil {
+			return err
+		}
+		return prepared.QueryRowContext(ctx, args...).Scan(dest...)
+	}
+	return err
+}
@@ -0,0 +1,36 @@
+package mariadbstore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReprepare(t *testing.T) {
+	s, db := newFakeStore(t)
+	db.invalidate()
+
+	ctx := context.Background()
+	for i := range 3 {
+		if _, err := s.execStmt(ctx, s.touchStmt, time.Now().Unix(), time.Now().Unix(), "1"); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	if prepared := s.current(s.touchStmt); prepared == s.touchStmt {
+		t.Error("the rejected statement is still used")
+	}
+	db.mu.Lock()
+	prepared := db.prepared - db.stale
+	db.mu.Unlock()
+	if prepared != 1 {
+		t.Errorf("statement was prepared %d times, want once", prepared)
+	}
+
+	var n int
+	if err := s.scanStmt(ctx, s.healthStmt, []any{&n}); err == nil || needsReprepare(err) {
+		t.Errorf("scanStmt = %v, want no rows from the prepared query", err)
+	}
+	if prepared := s.current(s.healthStmt); prepared == s.healthStmt {
+		t.Error("the rejected query isn't prepared again")
+	}
+}
@@ -0,0 +1,98 @@
+package mariadbstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// RetryPolicy controls how writes are retried after transient errors such as
+// deadlocks, lock wait timeouts and dropped connections.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry. It doubles after
+	// every attempt up to MaxBackoff, with up to 50% random jitter added.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// MariaDB error numbers that are safe to retry.
+const (
+	errLockWaitTimeout = 1205
+	errLockDeadlock    = 1213
+	// Galera reports certification conflicts as deadlocks and uses this
+	// error on nodes that aren't synced with the cluster.
+	errWsrepNotReady = 1047
+)
+
+// retryable reports whether a write that failed with err can run again. The
+// driver only returns driver.ErrBadConn before a statement was sent, while
+// a connection lost with mysql.ErrInvalidConn may have run it, so only
+// idempotent writes are retried after that.
+func retryable(err error, idempotent bool) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == errLockWaitTimeout || myErr.Number == errLockDeadlock || myErr.Number == errWsrepNotReady
+	}
+	return errors.Is(err, driver.ErrBadConn) || idempotent && errors.Is(err, mysql.ErrInvalidConn)
+}
+
+// idempotent reports whether running stmt twice has the same effect as
+// running it once.
+func (s *MariadbStore) idempotent(stmt *sql.Stmt) bool {
+	switch stmt {
+	case s.insertStmt:
+		// the Galera upsert writes the same row again, while other inserts
+		// would add another session
+		return s.galera
+	case s.auditStmt:
+		return false
+	}
+	return true
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff << (attempt - 1)
+	if d <= 0 || (p.MaxBackoff > 0 && d > p.MaxBackoff) {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// exec runs a write statement, retrying transient errors according to the
+// store's retry policy. Statements inside a transaction are never retried
+// since a deadlock rolls back the whole transaction.
+func (s *MariadbStore) exec(ctx context.Context, stmt *sql.Stmt, args ...any) (sql.Result, error) {
+	return s.retrying(ctx, s.idempotent(stmt), func() (sql.Result, error) {
+		return s.execStmt(ctx, stmt, args...)
+	})
+}
+
+// retrying runs a write with exec's retries.
+func (s *MariadbStore) retrying(ctx context.Context, idempotent bool, write func() (sql.Result, error)) (sql.Result, error) {
+	_, inTx := txFrom(ctx)
+	for attempt := 1; ; attempt++ {
+		res, err := write()
+		if err == nil || inTx || attempt >= s.retry.MaxAttempts || !retryable(err, idempotent) {
+			return res, err
+		}
+
+		s.log(ctx, s.logLevels.DB, "retrying session store query", "attempt", attempt, "error", err)
+		t := time.NewTimer(s.retry.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, err
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package mariadbstore
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		// the shift overflows
+		{70, time.Second},
+	}
+	for _, tt := range tests {
+		for range 20 {
+			d := p.backoff(tt.attempt)
+			if d < tt.base || d > tt.base+tt.base/2 {
+				t.Errorf("attempt %d: backoff %v, want %v plus up to 50%% jitter", tt.attempt, d, tt.base)
+				break
+			}
+		}
+	}
+
+	if d := (RetryPolicy{}).backoff(1); d != 0 {
+		t.Errorf("backoff without durations = %v, want 0", d)
+	}
+	if d := (RetryPolicy{InitialBackoff: time.Second}).backoff(3); d < 4*time.Second || d > 6*time.Second {
+		t.Errorf("backoff without a maximum = %v, want 4s plus jitter", d)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err           error
+		idempotent    bool
+		nonIdempotent bool
+	}{
+		{&mysql.MySQLError{Number: errLockDeadlock}, true, true},
+		{&mysql.MySQLError{Number: errLockWaitTimeout}, true, true},
+		{fmt.Errorf("wrapped: %w", &mysql.MySQLError{Number: errWsrepNotReady}), true, true},
+		{&mysql.MySQLError{Number: 1062}, false, false},
+		{driver.ErrBadConn, true, true},
+		{mysql.ErrInvalidConn, true, false},
+		{errors.New("syntax error"), false, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err, true); got != tt.idempotent {
+			t.Errorf("retryable(%v) for an idempotent write = %v, want %v", tt.err, got, tt.idempotent)
+		}
+		if got := retryable(tt.err, false); got != tt.nonIdempotent {
+			t.Errorf("retryable(%v) for an insert = %v, want %v", tt.err, got, tt.nonIdempotent)
+		}
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	s := &MariadbStore{insertStmt: &sql.Stmt{}, auditStmt: &sql.Stmt{}, updateStmt: &sql.Stmt{}}
+	if s.idempotent(s.insertStmt) {
+		t.Error("insert is idempotent")
+	}
+	if s.idempotent(s.auditStmt) {
+		t.Error("audit insert is idempotent")
+	}
+	if !s.idempotent(s.updateStmt) {
+		t.Error("update isn't idempotent")
+	}
+
+	s.galera = true
+	if !s.idempotent(s.insertStmt) {
+		t.Error("Galera upsert isn't idempotent")
+	}
+}
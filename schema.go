@@ -0,0 +1,244 @@
+package mariadbstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Columns names the columns of the sessions table. Empty fields keep the
+// default name.
+type Columns struct {
+	ID         string
+	Name       string
+	CreatedAt  string
+	LastActive string
+	Expires    string
+	Data       string
+	UpdatedAt  string
+	ClientIP   string
+	UserAgent  string
+	// Fingerprint is only used with WithSessionBinding.
+	Fingerprint string
+	// UserID is only used with WithMaxSessionsPerUser.
+	UserID string
+	// Options is only used with WithPersistedOptions.
+	Options string
+	// DeletedAt is only used with WithSoftDelete.
+	DeletedAt string
+}
+
+var defaultColumns = Columns{
+	ID:          "id",
+	Name:        "name",
+	CreatedAt:   "created_at",
+	LastActive:  "last_active",
+	Expires:     "expires",
+	Data:        "session_data",
+	UpdatedAt:   "updated_at",
+	ClientIP:    "client_ip",
+	UserAgent:   "user_agent",
+	Fingerprint: "fingerprint",
+	UserID:      "user_id",
+	Options:     "options",
+	DeletedAt:   "deleted_at",
+}
+
+// withDefaults fills empty column names with the default ones.
+func (c Columns) withDefaults() Columns {
+	fill := func(name *string, def string) {
+		if *name == "" {
+			*name = def
+		}
+	}
+	fill(&c.ID, defaultColumns.ID)
+	fill(&c.Name, defaultColumns.Name)
+	fill(&c.CreatedAt, defaultColumns.CreatedAt)
+	fill(&c.LastActive, defaultColumns.LastActive)
+	fill(&c.Expires, defaultColumns.Expires)
+	fill(&c.Data, defaultColumns.Data)
+	fill(&c.UpdatedAt, defaultColumns.UpdatedAt)
+	fill(&c.ClientIP, defaultColumns.ClientIP)
+	fill(&c.UserAgent, defaultColumns.UserAgent)
+	fill(&c.Fingerprint, defaultColumns.Fingerprint)
+	fill(&c.UserID, defaultColumns.UserID)
+	fill(&c.Options, defaultColumns.Options)
+	fill(&c.DeletedAt, defaultColumns.DeletedAt)
+	return c
+}
+
+// SchemaTemplateData is passed to a template set with WithSchemaTemplate.
+type SchemaTemplateData struct {
+	// Table is the table name qualified with the database name. It and the
+	// column names are quoted with backticks.
+	Table        string
+	Columns      Columns
+	Engine       string
+	Charset      string
+	Collation    string
+	TableOptions string
+	// DataType is the type of the data column, LONGBLOB or JSON.
+	DataType string
+	// Partitioning is the PARTITION BY clause set with WithPartitioning.
+	Partitioning string
+	// RandomIDs is set with WithGaleraMode and WithIDGenerator, whose
+	// session IDs are strings instead of AUTO_INCREMENT numbers.
+	RandomIDs bool
+}
+
+const defaultSchemaTemplate = `CREATE TABLE IF NOT EXISTS {{.Table}} (
+	{{.Columns.ID}} {{if .RandomIDs}}VARCHAR(64) NOT NULL{{else}}INT NOT NULL AUTO_INCREMENT{{end}},
+	{{.Columns.Name}} VARCHAR(255) NOT NULL DEFAULT '',
+	{{.Columns.CreatedAt}} INT NOT NULL DEFAULT 0,
+	{{.Columns.LastActive}} INT NOT NULL DEFAULT 0,
+	{{.Columns.Expires}} INT NOT NULL,
+	{{.Columns.Data}} {{.DataType}},
+	{{.Columns.UpdatedAt}} INT NOT NULL DEFAULT 0,
+	{{.Columns.ClientIP}} VARCHAR(45) NOT NULL DEFAULT '',
+	{{.Columns.UserAgent}} VARCHAR(512) NOT NULL DEFAULT '',
+	{{.Columns.Fingerprint}} VARBINARY(32) NOT NULL DEFAULT '',
+	{{.Columns.UserID}} VARCHAR(255) NOT NULL DEFAULT '',
+	{{.Columns.Options}} VARCHAR(255) NOT NULL DEFAULT '',
+	{{.Columns.DeletedAt}} INT NOT NULL DEFAULT 0,
+	PRIMARY KEY ({{.Columns.ID}}{{if .Partitioning}}, {{.Columns.Expires}}{{end}}),
+	INDEX ({{.Columns.UserID}}),
+	INDEX ({{.Columns.Expires}})
+) ENGINE={{.Engine}}
+{{- if .Charset}} DEFAULT CHARSET={{.Charset}}{{end}}
+{{- if .Collation}} COLLATE={{.Collation}}{{end}}
+{{- if .TableOptions}} {{.TableOptions}}{{end}}
+{{- if .Partitioning}} {{.Partitioning}}{{end}}`
+
+var defaultSchema = template.Must(template.New("schema").Parse(defaultSchemaTemplate))
+
+// table returns the quoted table name qualified with the database name.
+func (s *MariadbStore) table() string {
+	return s.qualified(s.tableName)
+}
+
+func (s *MariadbStore) newReplacer() *strings.Replacer {
+	c := s.columns.quoted()
+	return strings.NewReplacer(
+		"{table}", s.table(),
+		"{version_table}", s.qualified(s.versionTable()),
+		"{audit_table}", s.auditTable(),
+		"{cleanup_event}", s.qualified(s.cleanupEvent()),
+		"{id}", c.ID,
+		"{name}", c.Name,
+		"{created_at}", c.CreatedAt,
+		"{last_active}", c.LastActive,
+		"{expires}", c.Expires,
+		"{session_data}", c.Data,
+		"{updated_at}", c.UpdatedAt,
+		"{client_ip}", c.ClientIP,
+		"{user_agent}", c.UserAgent,
+		"{fingerprint}", c.Fingerprint,
+		"{user_id}", c.UserID,
+		"{options}", c.Options,
+		"{deleted_at}", c.DeletedAt,
+		"{live}", s.liveCondition(),
+	)
+}
+
+// sql expands the {table} and {column} placeholders in a query with the
+// quoted names.
+func (s *MariadbStore) sql(query string) string {
+	return s.replacer.Replace(query)
+}
+
+// createSchema creates the table or brings an older one up to date. Every
+// migration is written to be idempotent, so they are all applied without
+// tracking versions.
+func (s *MariadbStore) createSchema() error {
+	ctx := context.Background()
+	if err := s.createDatabase(ctx); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if err := m.up(ctx, s); err != nil {
+			return fmt.Errorf("schema migration %d (%s): %w", m.version, m.description, err)
+		}
+	}
+
+	return s.createOptionalSchema(ctx)
+}
+
+// createOptionalSchema creates the tables and columns used by optional
+// features, which aren't tracked as migrations.
+func (s *MariadbStore) createOptionalSchema(ctx context.Context) error {
+	if err := s.createIndexedFields(ctx); err != nil {
+		return err
+	}
+	if s.stringIDs() {
+		if err := s.convertIDColumn(ctx); err != nil {
+			return err
+		}
+	}
+	if s.dbCleanup > 0 {
+		if err := s.createCleanupEvent(ctx); err != nil {
+			return err
+		}
+	}
+	if s.auditName != "" {
+		return s.createAuditTable(ctx)
+	}
+	return nil
+}
+
+func (s *MariadbStore) dataType() string {
+	if s.jsonStorage {
+		return "JSON"
+	}
+	return "LONGBLOB"
+}
+
+func (s *MariadbStore) createDatabase(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE DATABASE IF NOT EXISTS `+quoteIdentifier(s.databaseName))
+	return err
+}
+
+// createTable runs the schema template.
+func (s *MariadbStore) createTable(ctx context.Context) error {
+	var createTableQuery bytes.Buffer
+	data := SchemaTemplateData{
+		Table:        s.table(),
+		Columns:      s.columns.quoted(),
+		DataType:     s.dataType(),
+		Engine:       s.engine,
+		Charset:      s.charset,
+		Collation:    s.collation,
+		TableOptions: s.tableOptions,
+		Partitioning: s.partitioning(),
+		RandomIDs:    s.stringIDs(),
+	}
+	if err := s.schemaTemplate.Execute(&createTableQuery, data); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, createTableQuery.String())
+	return err
+}
+
+// checkSchema verifies that the table exists and has every column the store
+// uses, without modifying it.
+func (s *MariadbStore) checkSchema(ctx context.Context) error {
+	query := s.sql(`SELECT {id}, {name}, {created_at}, {last_active}, {expires}, {session_data}` + s.metaSelect() + s.loadColumns() + ` FROM {table} LIMIT 0`)
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("sessions table %s is not usable: %w", s.table(), err)
+	}
+	return rows.Close()
+}
+
+// EnsureSchema creates the sessions database and table, or adds missing
+// columns to an existing table, using the schema options in opts. Use it from
+// provisioning tools when the application runs with WithSkipSchemaCreation.
+func EnsureSchema(db DB, databaseName, tableName string, opts ...Option) error {
+	s, err := newStore(db, databaseName, tableName, opts...)
+	if err != nil {
+		return err
+	}
+	return s.createSchema()
+}
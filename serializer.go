@@ -0,0 +1,93 @@
+package mariadbstore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/shamaton/msgpack/v2"
+)
+
+// Serializer converts session values to and from the representation stored
+// in the session_data column.
+type Serializer interface {
+	Serialize(session *sessions.Session) ([]byte, error)
+	Deserialize(data []byte, session *sessions.Session) error
+}
+
+// securecookieSerializer is the default serializer. It encodes values with
+// the store's codecs, which is how session data has always been stored.
+type securecookieSerializer struct {
+	store *MariadbStore
+}
+
+func (ss securecookieSerializer) Serialize(session *sessions.Session) ([]byte, error) {
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values, ss.store.codecsFor(session.Name())...)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(encoded), nil
+}
+
+func (ss securecookieSerializer) Deserialize(data []byte, session *sessions.Session) error {
+	return ss.store.decodeValue(session.Name(), string(data), &session.Values, ss.store.rowCodecsFor(session.Name()))
+}
+
+// GobSerializer stores session values using encoding/gob. Custom types must
+// be registered with gob.Register.
+type GobSerializer struct{}
+
+func (GobSerializer) Serialize(session *sessions.Session) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(session.Values); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobSerializer) Deserialize(data []byte, session *sessions.Session) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(&session.Values)
+}
+
+// JSONSerializer stores session values as a JSON object. All keys must be
+// strings and values come back with the types encoding/json decodes into,
+// e.g. numbers are float64.
+type JSONSerializer struct{}
+
+func (JSONSerializer) Serialize(session *sessions.Session) ([]byte, error) {
+	values := make(map[string]interface{}, len(session.Values))
+	for k, v := range session.Values {
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("non-string key value, cannot serialize session to JSON: %v", k)
+		}
+		values[key] = v
+	}
+	return json.Marshal(values)
+}
+
+func (JSONSerializer) Deserialize(data []byte, session *sessions.Session) error {
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	for k, v := range values {
+		session.Values[k] = v
+	}
+	return nil
+}
+
+// MsgpackSerializer stores session values using MessagePack, which is more
+// compact than gob or JSON and supports non-string keys.
+type MsgpackSerializer struct{}
+
+func (MsgpackSerializer) Serialize(session *sessions.Session) ([]byte, error) {
+	return msgpack.Marshal(session.Values)
+}
+
+func (MsgpackSerializer) Deserialize(data []byte, session *sessions.Session) error {
+	return msgpack.Unmarshal(data, &session.Values)
+}
@@ -0,0 +1,48 @@
+package mariadbstore
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// storedOptions are the session options kept with WithPersistedOptions.
+type storedOptions struct {
+	MaxAge      int           `json:"max_age"`
+	Secure      bool          `json:"secure"`
+	SameSite    http.SameSite `json:"same_site"`
+	Partitioned bool          `json:"partitioned,omitempty"`
+}
+
+func optionsOf(o *sessions.Options) storedOptions {
+	return storedOptions{MaxAge: o.MaxAge, Secure: o.Secure, SameSite: o.SameSite, Partitioned: o.Partitioned}
+}
+
+// encodeOptions returns the value of the options column. Sessions using the
+// store defaults store nothing so they follow later changes to the defaults.
+func (s *MariadbStore) encodeOptions(session *sessions.Session) string {
+	opts := optionsOf(session.Options)
+	defaults := s.optionsFor(session.Name())
+	if opts == optionsOf(&defaults) {
+		return ""
+	}
+	b, _ := json.Marshal(opts)
+	return string(b)
+}
+
+// restoreOptions applies options stored by encodeOptions to session.
+func restoreOptions(session *sessions.Session, stored string) error {
+	if stored == "" {
+		return nil
+	}
+	var opts storedOptions
+	if err := json.Unmarshal([]byte(stored), &opts); err != nil {
+		return err
+	}
+	session.Options.MaxAge = opts.MaxAge
+	session.Options.Secure = opts.Secure
+	session.Options.SameSite = opts.SameSite
+	session.Options.Partitioned = opts.Partitioned
+	return nil
+}
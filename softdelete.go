@@ -0,0 +1,55 @@
+package mariadbstore
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// liveCondition restricts queries to sessions that haven't been soft
+// deleted. It expands the {live} placeholder.
+func (s *MariadbStore) liveCondition() string {
+	if s.softDelete <= 0 {
+		return ""
+	}
+	return " AND " + quoteIdentifier(s.columns.DeletedAt) + " = 0"
+}
+
+// listCondition replaces {live} in listings, which can include the sessions
+// soft deleted within the grace period. Its argument is the earliest
+// deletion time listed.
+func (s *MariadbStore) listCondition() string {
+	if s.softDelete <= 0 {
+		return ""
+	}
+	return " AND ({deleted_at} = 0 OR {deleted_at} >= ?)"
+}
+
+// listArgs returns the arguments of listCondition.
+func (s *MariadbStore) listArgs(includeDeleted bool, now time.Time) []any {
+	if s.softDelete <= 0 {
+		return nil
+	}
+	if !includeDeleted {
+		return []any{int64(math.MaxInt64)}
+	}
+	return []any{now.Add(-s.softDelete).Unix()}
+}
+
+// deletedSelect returns the deletion time column to select in listings.
+func (s *MariadbStore) deletedSelect() string {
+	if s.softDelete <= 0 {
+		return ""
+	}
+	return ", {deleted_at}"
+}
+
+// purgeDeleted permanently removes sessions soft deleted longer than the
+// grace period ago.
+func (s *MariadbStore) purgeDeleted(ctx context.Context, now time.Time) (int64, error) {
+	res, err := s.execStmt(ctx, s.purgeDeletedStmt, now.Add(-s.softDelete).Unix())
+	if err != nil {
+		return 0, s.dbError(ctx, "cleanup", "", err)
+	}
+	return res.RowsAffected()
+}
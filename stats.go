@@ -0,0 +1,77 @@
+package mariadbstore
+
+import (
+	"context"
+	"time"
+)
+
+// CleanupResult describes a run of CleanExpired.
+type CleanupResult struct {
+	Time     time.Time
+	Duration time.Duration
+	// Purged is the number of sessions deleted before the run finished or
+	// failed with Err.
+	Purged int64
+	Err    error
+}
+
+// LastCleanup returns when the last cleanup run by this store started, the
+// number of sessions it purged and the error it failed with. The time is zero
+// if no cleanup ran yet.
+func (s *MariadbStore) LastCleanup() (time.Time, int64, error) {
+	last := s.lastResult.Load()
+	if last == nil {
+		return time.Time{}, 0, nil
+	}
+	return last.Time, last.Purged, last.Err
+}
+
+// Stats summarizes the sessions table.
+type Stats struct {
+	// Sessions is the number of sessions that haven't expired.
+	Sessions int64
+	// Expired is the number of expired sessions not purged yet.
+	Expired int64
+	// AvgPayloadBytes is the average size of the stored session data.
+	AvgPayloadBytes float64
+	// OldestSession is the age of the oldest session that hasn't expired.
+	// It is zero for tables without creation times.
+	OldestSession time.Duration
+	// LastCleanup is the result of the last cleanup run by this store, or
+	// the zero value if none ran yet.
+	LastCleanup CleanupResult
+}
+
+// Stats computes statistics about the stored sessions with a single
+// aggregate query, run on the read replica when there is one. It scans the
+// whole table, so don't call it on every request.
+func (s *MariadbStore) Stats(ctx context.Context) (Stats, error) {
+	if err := s.checkOpen(); err != nil {
+		return Stats{}, err
+	}
+
+	db := s.db
+	if s.readDB != nil {
+		db = s.readDB
+	}
+
+	var stats Stats
+	var oldest int64
+	now := time.Now()
+	err := db.QueryRowContext(ctx, s.sql(`SELECT
+			COALESCE(SUM({expires} > ?), 0),
+			COALESCE(SUM({expires} <= ?), 0),
+			COALESCE(AVG(LENGTH({session_data})), 0),
+			COALESCE(MIN(IF({expires} > ?, NULLIF({created_at}, 0), NULL)), 0)
+		FROM {table} WHERE TRUE{live}`), now.Unix(), now.Unix(), now.Unix()).Scan(&stats.Sessions, &stats.Expired, &stats.AvgPayloadBytes, &oldest)
+	if err != nil {
+		return Stats{}, s.dbError(ctx, "stats", "", err)
+	}
+	if oldest > 0 {
+		stats.OldestSession = now.Sub(time.Unix(oldest, 0))
+	}
+	if last := s.lastResult.Load(); last != nil {
+		stats.LastCleanup = *last
+	}
+	return stats, nil
+}
@@ -1,275 +1,1147 @@
 package mariadbstore
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 type MariadbStore struct {
-	db               *sql.DB
+	db               DB
+	ownedDB          *sql.DB
 	databaseName     string
 	tableName        string
+	columns          Columns
+	engine           string
+	charset          string
+	collation        string
+	tableOptions     string
+	schemaTemplate   *template.Template
+	replacer         *strings.Replacer
 	insertStmt       *sql.Stmt
 	updateStmt       *sql.Stmt
 	selectStmt       *sql.Stmt
-	selectAllStmt    *sql.Stmt
+	cleanStmt        *sql.Stmt
 	deleteStmt       *sql.Stmt
+	listStmt         *sql.Stmt
+	countStmt        *sql.Stmt
+	readDB           DB
+	readSelectStmt   *sql.Stmt
+	readListStmt     *sql.Stmt
+	readCountStmt    *sql.Stmt
+	batchStmt        *sql.Stmt
+	rewriteStmt      *sql.Stmt
+	touchStmt        *sql.Stmt
+	existsStmt       *sql.Stmt
+	healthStmt       *sql.Stmt
+	purgeStmt        *sql.Stmt
+	lockStmt         *sql.Stmt
+	userStmt         *sql.Stmt
+	expiredStmt      *sql.Stmt
+	auditStmt        *sql.Stmt
+	softDeleteStmt   *sql.Stmt
+	purgeDeletedStmt *sql.Stmt
+	serializer       Serializer
+	keyring          *Keyring
+	compression      Compression
+	compressMin      int
+	codecsMu         sync.RWMutex
+	keyPairs         [][]byte
+	rowCodecs        []securecookie.Codec
+	maxLength        int
+	maxDataSize      int
+	lazyPersist      bool
+	metadata         bool
+	binding          BindingPolicy
+	maxPerUser       int
+	limitPolicy      SessionLimitPolicy
+	hooks            Hooks
+	expiryHandler    func(context.Context, SessionInfo) error
+	auditName        string
+	jsonStorage      bool
+	persistOptions   bool
+	hybridLimit      int
+	detectTLS        bool
+	softDelete       time.Duration
+	partitionSize    time.Duration
+	dbCleanup        time.Duration
+	behind           *writeBehind
+	failurePolicy    FailurePolicy
+	breaker          *breaker
+	galera           bool
+	idGenerator      IDGenerator
+	badCookie        BadCookiePolicy
+	indexedFields    []indexedField
+	clientIP         func(*http.Request) string
+	skipSchema       bool
+	autoMigrate      bool
+	skipUnchanged    bool
+	touchOnRead      bool
+	deleteExpired    bool
+	expiration       ExpirationPolicy
+	cleanupInterval  time.Duration
+	browserTTL       time.Duration
+	started          time.Time
+	lastCleanup      atomic.Int64
+	lastResult       atomic.Pointer[CleanupResult]
+	cleanupErrors    func(context.Context, error)
+	retry            RetryPolicy
+	metrics          Metrics
+	cache            *rowCache
+	tracer           trace.Tracer
+	logger           Logger
+	logLevels        LogLevels
+	queries          map[*sql.Stmt]string
+	stmtDBs          map[*sql.Stmt]DB
+	repreparedMu     sync.RWMutex
+	reprepared       map[*sql.Stmt]*sql.Stmt
+	retired          []*sql.Stmt
+	cleanupLock      string
+	lockConn         *sql.Conn
 	Codecs           []securecookie.Codec
+	named            map[string]*namedSession
 	Options          *sessions.Options
 	stopChan         chan struct{}
 	doneStoppingChan chan struct{}
+	sweepCtx         context.Context
+	cancelSweep      context.CancelFunc
+	closeOnce        sync.Once
+	closed           atomic.Bool
+	drain            drainer
+	asyncStartup     bool
+	queryTimeout     time.Duration
+	cleanupTimeout   time.Duration
+	opts             []Option
+	tenant           string
+	tenants          *tenants
+	maxTenants       int
+	closedChan       chan struct{}
 }
 
-func NewMariadbStore(db *sql.DB, databaseName, tableName string, keyPairs ...[]byte) (*MariadbStore, error) {
-	if db == nil {
-		return nil, errors.New("db cannot be nil")
+func NewMariadbStore(db DB, databaseName, tableName string, keyPairs ...[]byte) (*MariadbStore, error) {
+	return NewMariadbStoreWithOptions(db, databaseName, tableName, WithKeyPairs(keyPairs...))
+}
+
+func NewMariadbStoreWithOptions(db DB, databaseName, tableName string, opts ...Option) (*MariadbStore, error) {
+	s, err := newStore(db, databaseName, tableName, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case s.skipSchema:
+		err = s.checkSchema(context.Background())
+	case s.autoMigrate:
+		err = s.Migrate(context.Background())
+	default:
+		err = s.createSchema()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	set := `{id}=?, {name}=?, {created_at}=?, {last_active}=?, {expires}=?, {session_data}=?` + s.metaColumns(true)
+	switch {
+	case s.galera:
+		// writes are idempotent, so a retry after a certification conflict
+		// can't fail on a row the first attempt committed
+		s.insertStmt, err = s.prepare(upsert(set, set[len(`{id}=?, `):]))
+	case s.idGenerator != nil:
+		s.insertStmt, err = s.prepare(`INSERT INTO {table} SET ` + set)
+	default:
+		s.insertStmt, err = s.prepare(`INSERT INTO {table} SET {name}=?, {created_at}=?, {last_active}=?, {expires}=?, {session_data}=?` + s.metaColumns(true))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.updateStmt, err = s.prepare(`UPDATE {table} SET {last_active}=?, {expires}=?, {session_data}=?` + s.metaColumns(true) + ` WHERE {id}=?{live}`)
+	if err != nil {
+		return nil, err
+	}
+
+	s.existsStmt, err = s.prepare(`SELECT 1 FROM {table} WHERE {id}=?{live}`)
+	if err != nil {
+		return nil, err
+	}
+
+	s.healthStmt, err = s.prepare(`SELECT 1`)
+	if err != nil {
+		return nil, err
+	}
+
+	s.selectStmt, err = s.prepare(`SELECT {created_at}, {last_active}, {expires}, {session_data}` + s.loadColumns() + ` FROM {table} WHERE {id}=? AND {expires} > ?{live}`)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cleanStmt, err = s.prepare(`DELETE FROM {table} WHERE {expires} < ?{live}`)
+	if err != nil {
+		return nil, err
 	}
 
-	createDatabaseQuery := fmt.Sprintf(`CREATE DATABASE IF NOT EXISTS %s`, databaseName)
-	if _, err := db.Exec(createDatabaseQuery); err != nil {
+	s.deleteStmt, err = s.prepare(`DELETE FROM {table} WHERE {id}=?`)
+	if err != nil {
+		return nil, err
+	}
+
+	s.listStmt, err = s.prepare(`SELECT {id}, {name}, {created_at}, {last_active}, {expires}, {session_data}` + s.metaSelect() + s.deletedSelect() + ` FROM {table} WHERE {expires} > ?` + s.listCondition() + ` ORDER BY {id} LIMIT ? OFFSET ?`)
+	if err != nil {
 		return nil, err
 	}
 
-	createTableQuery := fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS %s (
-			id INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
-			expires INT NOT NULL,
-			session_data LONGBLOB
-		) ENGINE=InnoDB;
-	`, tableName)
-	if _, err := db.Exec(createTableQuery); err != nil {
+	s.countStmt, err = s.prepare(`SELECT COUNT(*) FROM {table} WHERE {expires} > ?{live}`)
+	if err != nil {
 		return nil, err
 	}
 
-	insertStmt, err := db.Prepare(fmt.Sprintf(`INSERT INTO %s.%s SET expires=?, session_data=?`, databaseName, tableName))
+	s.batchStmt, err = s.prepare(`SELECT {id}, {name}, {session_data} FROM {table} WHERE {id} > ? ORDER BY {id} LIMIT ?`)
 	if err != nil {
 		return nil, err
 	}
 
-	updateStmt, err := db.Prepare(fmt.Sprintf(`UPDATE %s.%s SET expires=?, session_data=?`, databaseName, tableName))
+	s.rewriteStmt, err = s.prepare(`UPDATE {table} SET {session_data}=? WHERE {id}=? AND {session_data}=?`)
 	if err != nil {
 		return nil, err
 	}
 
-	selectStmt, err := db.Prepare(fmt.Sprintf(`SELECT session_data FROM %s.%s WHERE id=?`, databaseName, tableName))
+	s.lockStmt, err = s.prepare(`SELECT {created_at}, {last_active}, {expires}, {session_data}` + s.loadColumns() + ` FROM {table} WHERE {id}=? AND {expires} > ?{live} FOR UPDATE`)
 	if err != nil {
 		return nil, err
 	}
 
-	selectAllStmt, err := db.Prepare(fmt.Sprintf(`SELECT id, expires FROM %s.%s`, databaseName, tableName))
+	if s.auditName != "" {
+		s.auditStmt, err = s.prepare(`INSERT INTO {audit_table} SET session_id=?, event=?, user_id=?, client_ip=?, user_agent=?, occurred_at=?`)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.reportsExpiry() {
+		s.expiredStmt, err = s.prepare(`SELECT {id}, {name}, {created_at}, {expires}, {session_data} FROM {table} WHERE {expires} < ?{live} AND {id} > ? ORDER BY {id} LIMIT ?`)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.softDelete > 0 {
+		s.softDeleteStmt, err = s.prepare(`UPDATE {table} SET {deleted_at}=? WHERE {id}=?{live}`)
+		if err != nil {
+			return nil, err
+		}
+
+		s.purgeDeletedStmt, err = s.prepare(`DELETE FROM {table} WHERE {deleted_at} > 0 AND {deleted_at} < ?`)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.maxPerUser > 0 {
+		s.userStmt, err = s.prepare(`SELECT {id} FROM {table} WHERE {user_id}=? AND {expires} > ?{live} AND {id} <> ? ORDER BY {created_at}, {id} FOR UPDATE`)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.purgeStmt, err = s.prepare(`DELETE FROM {table} WHERE {id}=? AND {expires} <= ?{live}`)
 	if err != nil {
 		return nil, err
 	}
 
-	deleteStmt, err := db.Prepare(fmt.Sprintf(`	DELETE FROM %s.%s WHERE id=?`, databaseName, tableName))
+	s.touchStmt, err = s.prepare(`UPDATE {table} SET {last_active}=?, {expires}=?` + s.metaColumns(false) + ` WHERE {id}=?{live}`)
 	if err != nil {
 		return nil, err
 	}
 
+	if s.readDB != nil {
+		if err := s.prepareReplica(); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.cleanupInterval > 0 {
+		if !s.asyncStartup {
+			s.sweep(context.Background())
+		}
+		go s.loop()
+	}
+	if s.behind != nil {
+		go s.flushLoop()
+	}
+
+	return s, nil
+}
+
+// newStore creates a store with its options applied but no statements
+// prepared.
+func newStore(db DB, databaseName, tableName string, opts ...Option) (*MariadbStore, error) {
+	if isNil(db) {
+		return nil, errors.New("db cannot be nil")
+	}
+
 	s := &MariadbStore{
-		db:            db,
-		databaseName:  databaseName,
-		tableName:     tableName,
-		insertStmt:    insertStmt,
-		updateStmt:    updateStmt,
-		selectStmt:    selectStmt,
-		selectAllStmt: selectAllStmt,
-		deleteStmt:    deleteStmt,
-		Codecs:        securecookie.CodecsFromPairs(keyPairs...),
+		db:             db,
+		databaseName:   databaseName,
+		tableName:      tableName,
+		columns:        defaultColumns,
+		engine:         "InnoDB",
+		schemaTemplate: defaultSchema,
 		Options: &sessions.Options{
-			Path:   "/",
-			MaxAge: 86400 * 30,
+			Path:     "/",
+			MaxAge:   86400 * 30,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
 		},
+		detectTLS:        true,
+		cleanupInterval:  time.Hour * 24,
+		browserTTL:       time.Hour * 24,
+		maxLength:        -1,
+		maxTenants:       defaultMaxTenants,
+		started:          time.Now(),
+		metrics:          noopMetrics{},
+		tracer:           noop.NewTracerProvider().Tracer(""),
+		logLevels:        defaultLogLevels,
+		clientIP:         RemoteAddrIP,
+		queries:          make(map[*sql.Stmt]string),
+		stmtDBs:          make(map[*sql.Stmt]DB),
+		reprepared:       make(map[*sql.Stmt]*sql.Stmt),
 		stopChan:         make(chan struct{}),
 		doneStoppingChan: make(chan struct{}),
+		closedChan:       make(chan struct{}),
 	}
+	s.sweepCtx, s.cancelSweep = context.WithCancel(context.Background())
+	s.serializer = securecookieSerializer{store: s}
+	s.opts = opts
 
-	s.cleanExpiredSessions()
-	go s.loop()
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkIdentifiers(); err != nil {
+		return nil, err
+	}
+	if err := s.checkJSONStorage(); err != nil {
+		return nil, err
+	}
+	if err := s.checkPartitioning(); err != nil {
+		return nil, err
+	}
+	if err := s.checkDatabaseCleanup(); err != nil {
+		return nil, err
+	}
+	s.replacer = s.newReplacer()
 
 	return s, nil
 }
 
+// Close stops the cleanup goroutine and releases the store's statements. It
+// is safe to call more than once.
 func (s *MariadbStore) Close() {
-	s.stopChan <- struct{}{}
-	<-s.doneStoppingChan
+	s.CloseContext(context.Background())
+}
+
+// CloseContext is like Close but returns ctx.Err() if ctx is done before the
+// store has shut down. A cleanup that is in progress is canceled. Store
+// methods called after Close return ErrStoreClosed.
+func (s *MariadbStore) CloseContext(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		s.closed.Store(true)
+		s.cancelSweep()
+		go s.shutdown()
+	})
+
+	select {
+	case <-s.closedChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *MariadbStore) shutdown() {
+	s.eachTenant(func(t *MariadbStore) { t.Close() })
+	if s.cleanupInterval > 0 {
+		close(s.stopChan)
+		<-s.doneStoppingChan
+	}
+	s.resign()
+	if s.behind != nil {
+		close(s.behind.stop)
+		<-s.behind.done
+		if err := s.flush(context.Background()); err != nil {
+			s.log(context.Background(), s.logLevels.DB, "session write-behind flush failed", "error", err)
+		}
+	}
 
 	s.insertStmt.Close()
 	s.updateStmt.Close()
 	s.selectStmt.Close()
+	s.cleanStmt.Close()
 	s.deleteStmt.Close()
+	s.listStmt.Close()
+	s.countStmt.Close()
+	s.batchStmt.Close()
+	s.rewriteStmt.Close()
+	s.touchStmt.Close()
+	s.existsStmt.Close()
+	s.healthStmt.Close()
+	s.purgeStmt.Close()
+	s.lockStmt.Close()
+	if s.userStmt != nil {
+		s.userStmt.Close()
+	}
+	if s.expiredStmt != nil {
+		s.expiredStmt.Close()
+	}
+	if s.auditStmt != nil {
+		s.auditStmt.Close()
+	}
+	if s.softDeleteStmt != nil {
+		s.softDeleteStmt.Close()
+		s.purgeDeletedStmt.Close()
+	}
+	if s.readDB != nil {
+		s.readSelectStmt.Close()
+		s.readListStmt.Close()
+		s.readCountStmt.Close()
+	}
+	s.closeReprepared()
+
+	if s.ownedDB != nil {
+		s.ownedDB.Close()
+	}
+	close(s.closedChan)
 }
 
+// checkOpen returns ErrStoreClosed once Close has been called.
+func (s *MariadbStore) checkOpen() error {
+	if s.closed.Load() {
+		return ErrStoreClosed
+	}
+	return nil
+}
+
+type requestStatesKey struct{}
+
+// Get returns the named session of the request's sessions.Registry, which
+// creates it with New the first time. The registry attaches the store it's
+// given to the session, so it's given the session's own sessionStore, kept
+// in the request like the registry itself, and the session keeps its state.
 func (s *MariadbStore) Get(r *http.Request, name string) (*sessions.Session, error) {
-	return sessions.GetRegistry(r).Get(s, name)
+	states, _ := r.Context().Value(requestStatesKey{}).(map[string]*sessionStore)
+	if states == nil {
+		states = make(map[string]*sessionStore)
+		*r = *r.WithContext(context.WithValue(r.Context(), requestStatesKey{}, states))
+	}
+	st, ok := states[name]
+	if !ok {
+		st = &sessionStore{MariadbStore: s}
+		states[name] = st
+	}
+	return sessions.GetRegistry(r).Get(st, name)
 }
 
-func (s *MariadbStore) New(r *http.Request, name string) (*sessions.Session, error) {
-	session := sessions.NewSession(s, name)
-	opts := *s.Options
+func (s *MariadbStore) New(r *http.Request, name string) (session *sessions.Session, err error) {
+	return s.newWith(r, name, &sessionStore{})
+}
+
+// New creates the session Get asks the registry for, with st holding its
+// state.
+func (st *sessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	return st.MariadbStore.newWith(r, name, st)
+}
+
+// newWith is New for a session whose state is kept in st.
+func (s *MariadbStore) newWith(r *http.Request, name string, st *sessionStore) (session *sessions.Session, err error) {
+	t, err := s.storeFor(r)
+	if err != nil {
+		return s.unavailableTenant(name, st, err)
+	}
+	if t != s {
+		return t.newWith(r, name, st)
+	}
+
+	ctx, span := s.startSpan(r.Context(), "mariadbstore.New", nil)
+	defer func() { endSpan(span, err) }()
+
+	st.MariadbStore = s
+	session = s.newSession(st, name)
+	if err := s.checkOpen(); err != nil {
+		return session, err
+	}
+	err = s.guard(ctx, func() error { return s.open(ctx, r, session) })
+	return session, s.degradeOpen(ctx, session, err)
+}
+
+func (s *MariadbStore) newSession(st *sessionStore, name string) *sessions.Session {
+	session := sessions.NewSession(st, name)
+	opts := s.optionsFor(name)
 	session.Options = &opts
 	session.IsNew = true
+	return session
+}
+
+// open loads the session named in the request's cookie, or starts a new one.
+func (s *MariadbStore) open(ctx context.Context, r *http.Request, session *sessions.Session) error {
 	var err error
+	ctx = s.withClient(ctx, r)
+	name := session.Name()
 	if c, errCookie := r.Cookie(name); errCookie == nil {
-		err = securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...)
-		if err == nil {
-			err = s.load(session)
-			if err == nil {
-				session.IsNew = false
+		value, inCookie := strings.CutPrefix(c.Value, cookiePrefix)
+		if inCookie && !s.valuesCookies() {
+			err = errors.New("values cookie without hybrid storage")
+		} else if inCookie {
+			err = s.decodeValue(s.valuesName(name), value, &session.Values, s.codecsFor(name))
+		} else {
+			err = s.decodeValue(s.cookieName(name), c.Value, &session.ID, s.rowCodecsFor(name))
+		}
+		if err != nil {
+			s.log(ctx, s.logLevels.Decode, "session cookie decode failed", "name", name, "error", err)
+			err = fmt.Errorf("%w: %w", ErrDecodeFailed, err)
+		} else if !inCookie {
+			err = s.load(ctx, session)
+			if errors.Is(err, ErrDecodeFailed) {
+				s.deleteOrphan(ctx, session.ID)
 			}
 		}
+		if err == nil {
+			session.IsNew = false
+			track(session)
+		}
+	}
+
+	// the session can't be told apart from a missing one while the database
+	// is down, and saving it would replace the row with empty values
+	if errors.Is(err, ErrStoreUnavailable) {
+		session.Values = make(map[interface{}]interface{})
+		reject(session, err)
+		return err
+	}
+
+	// a session presented by another client is replaced but the caller is told
+	// about it
+	hijacked := errors.Is(err, ErrSessionHijackSuspected)
+	var bad error
+	if s.badCookie.Report && errors.Is(err, ErrDecodeFailed) {
+		bad = fmt.Errorf("%w: %w", ErrBadCookie, err)
 	}
 
 	// if the client has a session cookie but the session doesn't exist then create a
 	// new session for the client
 	if err != nil {
-		err = s.insert(session)
+		session.Values = make(map[interface{}]interface{})
+		if s.lazyPersist {
+			// the row is written by the first Save of a non-empty session
+			session.ID = ""
+			err = nil
+		} else if err = s.drain.beginWrite(); err == nil {
+			err = s.insert(ctx, session)
+			s.drain.endWrite()
+		} else {
+			// no row is written while draining, Save reports ErrStoreDraining
+			session.ID = ""
+			err = nil
+		}
+		if err == nil && hijacked {
+			err = ErrSessionHijackSuspected
+		}
+		if err == nil && bad != nil {
+			err = bad
+		}
 	}
 
-	return session, err
+	return err
 }
 
-func (s *MariadbStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
-	// Delete if max-age is <= 0
-	if session.Options.MaxAge <= 0 {
-		if err := s.erase(session.ID); err != nil {
+func (s *MariadbStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) (err error) {
+	if t, ok := s.tenantOf(session); ok {
+		return t.Save(r, w, session)
+	}
+	ctx, span := s.startSpan(r.Context(), "mariadbstore.Save", nil)
+	defer func() { endSpan(span, err) }()
+
+	if err := s.checkOpen(); err != nil {
+		return err
+	}
+	if err := rejected(session); err != nil {
+		return err
+	}
+	if err := s.drain.beginWrite(); err != nil {
+		s.unlock(session)
+		return err
+	}
+	defer s.drain.endWrite()
+	ctx = s.withClient(ctx, r)
+	ctx = s.withSecure(ctx, r)
+
+	// sessions from GetLocked are written in their transaction, which is
+	// committed once the save succeeds and rolled back otherwise
+	st := stateOf(session)
+	if st != nil && st.tx != nil {
+		ctx = withTx(ctx, st.tx, false)
+		defer func() {
+			if err != nil {
+				s.unlock(session)
+			}
+		}()
+	} else if s.degraded(session) {
+		return s.writeDegraded(ctx, w, session, errBreakerOpen)
+	}
+
+	err = s.guard(ctx, func() error { return s.write(ctx, w, session) })
+	if errors.Is(err, ErrStoreUnavailable) && s.failurePolicy != FailClosed && (st == nil || st.tx == nil) {
+		return s.writeDegraded(ctx, w, session, err)
+	}
+	return err
+}
+
+// write stores the session and sets its cookie.
+func (s *MariadbStore) write(ctx context.Context, w http.ResponseWriter, session *sessions.Session) error {
+	// Delete if max-age is < 0. A max-age of 0 is a browser session cookie.
+	if session.Options.MaxAge < 0 {
+		if err := s.erase(ctx, session.ID); err != nil && !errors.Is(err, ErrSessionNotFound) {
 			return err
 		}
-		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		if err := s.commit(session); err != nil {
+			return err
+		}
+		setCookie(ctx, w, session, "")
 		return nil
 	}
 
-	if session.ID == "" {
-		if err := s.insert(session); err != nil {
+	if session.ID == "" && s.lazyPersist && len(session.Values) == 0 {
+		return s.commit(session)
+	}
+
+	if s.hybridLimit > 0 && UserID(session) == "" {
+		value, err := s.cookieValue(session)
+		if err != nil {
 			return err
 		}
-	} else {
-		if err := s.save(session); err != nil {
-			return err
+		if len(value) <= s.hybridLimit {
+			return s.writeCookie(ctx, w, session, value)
 		}
 	}
 
-	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if s.skipSave(session, time.Now()) {
+		return s.commit(session)
+	}
+
+	persist := s.persist
+	if s.claimsUser(session) {
+		persist = s.persistForUser
+	}
+	if err := persist(ctx, session); err != nil {
+		return err
+	}
+	if err := s.commit(session); err != nil {
+		return err
+	}
+	track(session)
+
+	encoded, err := securecookie.EncodeMulti(s.cookieName(session.Name()), session.ID, s.codecsFor(session.Name())...)
 	if err != nil {
 		return err
 	}
-	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	setCookie(ctx, w, session, encoded)
 	return nil
 }
 
+// persist inserts, touches or updates the session row.
+func (s *MariadbStore) persist(ctx context.Context, session *sessions.Session) error {
+	if session.ID == "" {
+		return s.insert(ctx, session)
+	}
+	if s.touchOnRead && !modified(session) {
+		return s.touch(ctx, session)
+	}
+	return s.save(ctx, session)
+}
+
+// MaxAge sets the MaxAge of the default options and rebuilds the codecs from
+// the key pairs with it. A store without key pairs keeps the codecs assigned
+// to Codecs as they are.
 func (s *MariadbStore) MaxAge(age int) {
-	s.Options.MaxAge = age
+	s.codecsMu.Lock()
+	opts := *s.Options
+	opts.MaxAge = age
+	s.Options = &opts
+	s.rebuildCodecs()
+	s.codecsMu.Unlock()
 
-	// Set the maxAge for each securecookie instance.
-	for _, codec := range s.Codecs {
-		if sc, ok := codec.(*securecookie.SecureCookie); ok {
-			sc.MaxAge(age)
-		}
-	}
+	s.eachTenant(func(t *MariadbStore) { t.MaxAge(age) })
 }
 
+// MaxLength rebuilds the codecs from the key pairs with the maximum length of
+// cookies set to l. A store without key pairs keeps the codecs assigned to
+// Codecs as they are.
 func (s *MariadbStore) MaxLength(l int) {
-	for _, c := range s.Codecs {
-		if codec, ok := c.(*securecookie.SecureCookie); ok {
-			codec.MaxLength(l)
-		}
-	}
+	s.codecsMu.Lock()
+	s.maxLength = l
+	s.rebuildCodecs()
+	s.codecsMu.Unlock()
+
+	s.eachTenant(func(t *MariadbStore) { t.MaxLength(l) })
+}
+
+// SetOptions replaces the default options of new sessions and applies
+// opts.MaxAge to the codecs built from the key pairs. Unlike assigning to Options it is safe to call
+// while the store is serving requests.
+func (s *MariadbStore) SetOptions(opts sessions.Options) {
+	s.codecsMu.Lock()
+	s.Options = &opts
+	s.rebuildCodecs()
+	s.codecsMu.Unlock()
+
+	s.eachTenant(func(t *MariadbStore) { t.SetOptions(opts) })
 }
 
 func (s *MariadbStore) loop() {
-	t := time.NewTicker(time.Hour * 24)
+	t := time.NewTicker(s.cleanupInterval)
+	defer t.Stop()
+
+	if s.asyncStartup {
+		s.sweep(s.sweepCtx)
+	}
 
 	for {
 		select {
 		case <-t.C:
-			s.cleanExpiredSessions()
+			s.sweep(s.sweepCtx)
 		case <-s.stopChan:
-			s.doneStoppingChan <- struct{}{}
+			close(s.doneStoppingChan)
 			return
 		}
 	}
 }
 
-func (s *MariadbStore) cleanExpiredSessions() error {
-	now := time.Now().Unix()
+// sweep runs a periodic cleanup. With distributed cleanup enabled only the
+// instance holding the cleanup lock runs it.
+func (s *MariadbStore) sweep(ctx context.Context) {
+	s.drain.sweeping.Lock()
+	defer s.drain.sweeping.Unlock()
+	if s.drain.isDraining() {
+		return
+	}
+	if s.cleanupLock != "" && !s.lead(ctx) {
+		return
+	}
+	if _, err := s.CleanExpired(ctx); err != nil {
+		s.log(ctx, s.logLevels.Cleanup, "session cleanup failed", "error", err)
+		if s.cleanupErrors != nil {
+			s.cleanupErrors(ctx, err)
+		}
+	}
+}
+
+// CleanExpired deletes every expired session and returns the number of
+// deleted rows. The store calls it periodically unless WithoutCleanup is used.
+func (s *MariadbStore) CleanExpired(ctx context.Context) (purged int64, err error) {
+	ctx, span := s.startSpan(ctx, "mariadbstore.CleanExpired", s.cleanStmt)
+	defer func() { endSpan(span, err) }()
+
+	if err := s.checkOpen(); err != nil {
+		return 0, err
+	}
+	if s.cleanupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cleanupTimeout)
+		defer cancel()
+	}
+	ctx = withCleanupScope(ctx)
+
+	start := time.Now()
+	defer func() {
+		s.lastResult.Store(&CleanupResult{Time: start, Duration: time.Since(start), Purged: purged, Err: err})
+	}()
+
+	// held back refreshes are written first so their sessions aren't purged
+	if s.behind != nil {
+		if err := s.flush(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	if s.partitionSize > 0 {
+		purged, err = s.cleanPartitions(ctx, start)
+	}
+	if err == nil {
+		var n int64
+		if s.reportsExpiry() {
+			n, err = s.cleanEach(ctx, start)
+		} else {
+			n, err = s.cleanAll(ctx, start)
+		}
+		purged += n
+	}
+	if err == nil && s.softDelete > 0 {
+		var n int64
+		n, err = s.purgeDeleted(ctx, start)
+		purged += n
+	}
+	if err != nil {
+		return purged, err
+	}
+
+	s.lastCleanup.Store(start.UnixNano())
+	s.metrics.CleanupFinished(time.Since(start), purged)
+	return purged, nil
+}
+
+// cleanAll purges every expired session with a single DELETE.
+func (s *MariadbStore) cleanAll(ctx context.Context, now time.Time) (int64, error) {
+	res, err := s.execStmt(ctx, s.cleanStmt, now.Unix())
+	if err != nil {
+		return 0, s.dbError(ctx, "cleanup", "", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *MariadbStore) insert(ctx context.Context, session *sessions.Session) (err error) {
+	ctx, span := s.startSpan(ctx, "mariadbstore.insert", s.insertStmt)
+	defer func() { endSpan(span, err) }()
 
-	rows, err := s.selectAllStmt.Query()
+	encoded, err := s.encode(session)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var id string
-		var expires int64
-		err := rows.Scan(&id, &expires)
+
+	now := time.Now()
+	if st := stateOf(session); st != nil {
+		st.created = now
+	}
+
+	expires := s.expiry(session, now)
+	args := append([]any{session.Name(), now.Unix(), now.Unix(), expires, encoded}, s.metaArgs(ctx, session, now, true)...)
+	if s.stringIDs() {
+		id, err := s.newID(ctx)
 		if err != nil {
 			return err
 		}
-
-		if now > expires {
-			if err := s.erase(id); err != nil {
-				return err
-			}
+		if _, err := s.exec(ctx, s.insertStmt, append([]any{id}, args...)...); err != nil {
+			return s.dbError(ctx, "insert", "", err)
+		}
+		session.ID = id
+	} else {
+		res, err := s.exec(ctx, s.insertStmt, args...)
+		if err != nil {
+			return s.dbError(ctx, "insert", "", err)
 		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		session.ID = fmt.Sprintf("%d", id)
 	}
-	return rows.Err()
+	setExpires(session, expires)
+	s.cachePut(ctx, session.ID, sessionRow{created: now.Unix(), lastActive: now.Unix(), expires: expires, data: encoded, fingerprint: clientFrom(ctx).fingerprint, userID: UserID(session), options: s.encodeOptions(session)}, now)
+	s.metrics.SessionCreated()
+	s.metrics.PayloadSize(len(encoded))
+	s.emit(ctx, auditCreate, event(ctx, session, now))
+
+	return nil
 }
 
-func (s *MariadbStore) insert(session *sessions.Session) error {
-	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+func (s *MariadbStore) save(ctx context.Context, session *sessions.Session) (err error) {
+	ctx, span := s.startSpan(ctx, "mariadbstore.save", s.updateStmt)
+	defer func() { endSpan(span, err) }()
+
+	encoded, err := s.encode(session)
 	if err != nil {
 		return err
 	}
 
-	expires := time.Now().Add(time.Second * time.Duration(session.Options.MaxAge)).Unix()
+	if s.behind != nil {
+		s.behind.drop(session.ID)
+	}
 
-	res, err := s.insertStmt.Exec(expires, encoded)
+	now := time.Now()
+	expires := s.expiry(session, now)
+	var created int64
+	if st := stateOf(session); st != nil && !st.created.IsZero() {
+		created = st.created.Unix()
+	}
+
+	args := append([]any{now.Unix(), expires, encoded}, s.metaArgs(ctx, session, now, true)...)
+	res, err := s.exec(ctx, s.updateStmt, append(args, session.ID)...)
 	if err != nil {
-		return err
+		s.cache.remove(session.ID)
+		return s.dbError(ctx, "save", session.ID, err)
 	}
+	// the driver reports rows that matched without changing as unaffected,
+	// so the row is looked up before the session is reported as vanished
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		if err := s.exists(ctx, session.ID); err != nil {
+			s.cache.remove(session.ID)
+			return err
+		}
+	}
+	setExpires(session, expires)
+
+	s.cachePut(ctx, session.ID, sessionRow{created: created, lastActive: now.Unix(), expires: expires, data: encoded, fingerprint: clientFrom(ctx).fingerprint, userID: UserID(session), options: s.encodeOptions(session)}, now)
+
+	s.metrics.SessionSaved()
+	s.metrics.PayloadSize(len(encoded))
+	s.emit(ctx, auditRefresh, event(ctx, session, now))
+	return nil
+}
 
-	id, err := res.LastInsertId()
+// exists returns ErrSessionVanished if the session's row has been deleted.
+// Deleted sessions are never written again, so a logout or revocation
+// racing with a save isn't undone.
+func (s *MariadbStore) exists(ctx context.Context, id string) error {
+	var one int
+	err := s.scanStmt(ctx, s.existsStmt, []any{&one}, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.log(ctx, s.logLevels.DB, "saved session had been deleted", "session_id", id)
+		return fmt.Errorf("%w: %s", ErrSessionVanished, id)
+	}
 	if err != nil {
-		return err
+		return s.dbError(ctx, "save", id, err)
 	}
+	return nil
+}
+
+// touch extends the expiry of a session without rewriting its data.
+func (s *MariadbStore) touch(ctx context.Context, session *sessions.Session) (err error) {
+	ctx, span := s.startSpan(ctx, "mariadbstore.touch", s.touchStmt)
+	defer func() { endSpan(span, err) }()
 
-	session.ID = fmt.Sprintf("%d", id)
+	now := time.Now()
+	expires := s.expiry(session, now)
+	args := append([]any{now.Unix(), expires}, s.metaArgs(ctx, session, now, false)...)
+	setExpires(session, expires)
+	if _, inTx := txFrom(ctx); s.behind != nil && !inTx {
+		s.behind.add(session.ID, args)
+		s.cache.touch(session.ID, now.Unix(), expires)
+		s.metrics.SessionSaved()
+		s.emit(ctx, auditRefresh, event(ctx, session, now))
+		return nil
+	}
+	if _, err := s.exec(ctx, s.touchStmt, append(args, session.ID)...); err != nil {
+		s.cache.remove(session.ID)
+		return s.dbError(ctx, "touch", session.ID, err)
+	}
+	if _, ok := txFrom(ctx); ok {
+		s.cache.remove(session.ID)
+	} else {
+		s.cache.touch(session.ID, now.Unix(), expires)
+	}
 
+	s.metrics.SessionSaved()
+	s.emit(ctx, auditRefresh, event(ctx, session, now))
 	return nil
 }
 
-func (s *MariadbStore) save(session *sessions.Session) error {
-	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+func (s *MariadbStore) load(ctx context.Context, session *sessions.Session) (err error) {
+	ctx, span := s.startSpan(ctx, "mariadbstore.load", s.selectStmt)
+	defer func() { endSpan(span, err) }()
+
+	now := time.Now()
+	row, err := s.fetch(ctx, session.ID, now)
+	if err == sql.ErrNoRows {
+		return s.missing(ctx, session.ID, now)
+	}
 	if err != nil {
+		return s.dbError(ctx, "load", session.ID, err)
+	}
+
+	if s.expiration.expired(row.created, row.lastActive, now) {
+		return ErrSessionExpired
+	}
+
+	if err := s.checkBinding(ctx, session.ID, row.fingerprint); err != nil {
 		return err
 	}
 
-	expires := time.Now().Add(time.Second * time.Duration(session.Options.MaxAge)).Unix()
+	if err := restoreOptions(session, row.options); err != nil {
+		s.log(ctx, s.logLevels.Decode, "session options decode failed", "session_id", session.ID, "error", err)
+		return fmt.Errorf("%w: %w", ErrDecodeFailed, err)
+	}
 
-	_, err = s.updateStmt.Exec(expires, encoded)
-	return err
+	if st := stateOf(session); st != nil {
+		if row.created > 0 {
+			st.created = time.Unix(row.created, 0)
+		}
+		st.userID = row.userID
+		st.storedUserID = row.userID
+		st.expires = row.expires
+	}
+
+	if err := s.decode(row.data, session); err != nil {
+		s.log(ctx, s.logLevels.Decode, "session data decode failed", "session_id", session.ID, "error", err)
+		return fmt.Errorf("%w: %w", ErrDecodeFailed, err)
+	}
+
+	s.metrics.SessionLoaded()
+	return nil
+}
+
+// fetch reads the live row for id. Inside a transaction the row is read, and
+// locked if requested, through the transaction; otherwise it comes from the
+// cache or the read replica when they're configured.
+func (s *MariadbStore) fetch(ctx context.Context, id string, now time.Time) (sessionRow, error) {
+	var row sessionRow
+	dest := []any{&row.created, &row.lastActive, &row.expires, &row.data}
+	if s.binding.enabled() {
+		dest = append(dest, &row.fingerprint)
+	}
+	if s.maxPerUser > 0 {
+		dest = append(dest, &row.userID)
+	}
+	if s.persistOptions {
+		dest = append(dest, &row.options)
+	}
+
+	if scope, ok := txFrom(ctx); ok {
+		stmt := s.selectStmt
+		if scope.lock {
+			stmt = s.lockStmt
+		}
+		return row, s.scanStmt(ctx, stmt, dest, id, now.Unix())
+	}
+
+	if cached, ok := s.cache.get(id, now); ok {
+		return cached, nil
+	}
+	if err := s.readRow(ctx, s.readSelectStmt, s.selectStmt, dest, id, now.Unix()); err != nil {
+		return row, err
+	}
+	s.cache.put(id, row, now)
+	return row, nil
 }
 
-func (s *MariadbStore) load(session *sessions.Session) error {
-	var sessionData string
-	if err := s.selectStmt.QueryRow(session.ID).Scan(&sessionData); err != nil {
+// missing is called when load finds no live row for id. With
+// WithDeleteExpiredOnLoad an expired row is deleted right away, which also
+// tells it apart from a session that doesn't exist.
+func (s *MariadbStore) missing(ctx context.Context, id string, now time.Time) error {
+	// the row isn't read here, so sessions the expiry handler needs to see
+	// are left for the cleanup
+	if !s.deleteExpired || s.expiryHandler != nil {
+		return ErrSessionNotFound
+	}
+
+	s.cache.remove(id)
+	res, err := s.execStmt(ctx, s.purgeStmt, id, now.Unix())
+	if err != nil {
+		return s.dbError(ctx, "purge", id, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
 		return err
 	}
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+	s.metrics.SessionDeleted()
+	s.emit(ctx, auditExpire, SessionEvent{ID: id, Time: now})
+	return ErrSessionExpired
+}
 
-	if err := securecookie.DecodeMulti(session.Name(), string(sessionData), &session.Values, s.Codecs...); err != nil {
+// encode serializes the session values into the form stored in the database.
+func (s *MariadbStore) encode(session *sessions.Session) ([]byte, error) {
+	data, err := s.serializer.Serialize(session)
+	if err != nil {
+		return nil, err
+	}
+	if s.maxDataSize > 0 && len(data) > s.maxDataSize {
+		return nil, fmt.Errorf("%w: %d bytes, limit is %d", ErrSessionTooLarge, len(data), s.maxDataSize)
+	}
+	return s.seal(data)
+}
+
+// seal compresses and encrypts serialized session values.
+func (s *MariadbStore) seal(data []byte) ([]byte, error) {
+	data, err := s.compress(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.keyring != nil {
+		return s.keyring.encrypt(data)
+	}
+	return data, nil
+}
+
+// decode reverses encode, populating the session values from stored data.
+func (s *MariadbStore) decode(data []byte, session *sessions.Session) error {
+	data, err := s.unseal(data)
+	if err != nil {
 		return err
 	}
+	return s.serializer.Deserialize(data, session)
+}
 
-	return nil
+// unseal reverses seal, returning the serialized session values.
+func (s *MariadbStore) unseal(data []byte) ([]byte, error) {
+	if s.keyring != nil {
+		var err error
+		if data, err = s.keyring.decrypt(data); err != nil {
+			return nil, err
+		}
+	} else if len(data) > 0 && data[0] == encryptedMarker {
+		return nil, errors.New("session data is encrypted but no keyring is set")
+	}
+	return decompress(data)
 }
 
-func (s *MariadbStore) erase(id string) error {
-	_, err := s.deleteStmt.Exec(id)
-	return err
+// prepare prepares a query written with {table} and {column} placeholders.
+func (s *MariadbStore) prepare(query string) (*sql.Stmt, error) {
+	return s.prepareOn(s.db, query)
+}
+
+func (s *MariadbStore) prepareOn(db DB, query string) (*sql.Stmt, error) {
+	query = s.sql(query)
+	stmt, err := db.PrepareContext(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+	s.queries[stmt] = query
+	s.stmtDBs[stmt] = db
+	return stmt, nil
+}
+
+func (s *MariadbStore) erase(ctx context.Context, id string) (err error) {
+	ctx, span := s.startSpan(ctx, "mariadbstore.erase", s.deleteStmt)
+	defer func() { endSpan(span, err) }()
+
+	s.cache.remove(id)
+	if s.behind != nil {
+		s.behind.drop(id)
+	}
+	var res sql.Result
+	if s.softDelete > 0 {
+		res, err = s.exec(ctx, s.softDeleteStmt, time.Now().Unix(), id)
+	} else {
+		res, err = s.exec(ctx, s.deleteStmt, id)
+	}
+	if err != nil {
+		return s.dbError(ctx, "delete", id, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+
+	s.metrics.SessionDeleted()
+	s.emit(ctx, auditDelete, SessionEvent{ID: id, Time: time.Now()})
+	return nil
 }
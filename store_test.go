@@ -0,0 +1,144 @@
+package mariadbstore
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/agorman/mariadbstore/mariadbstoretest"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+func TestStore(t *testing.T) {
+	dsn := mariadbstoretest.MariaDB(t)
+	mariadbstoretest.Run(t, func(t *testing.T) sessions.Store {
+		store, err := NewMariadbStoreDSN(dsn, WithKeyPairs([]byte("secret")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(store.Close)
+		return store
+	})
+}
+
+// testStore returns a store with its options applied and nothing prepared,
+// for unit tests that don't need a database. The pool never connects.
+func testStore(t *testing.T, opts ...Option) *MariadbStore {
+	t.Helper()
+	s, err := newTestStore(t, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newTestStore(t *testing.T, opts ...Option) (*MariadbStore, error) {
+	t.Helper()
+	db, err := sql.Open("mysql", "test@tcp(127.0.0.1:1)/sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return newStore(db, "sessions", "sessions", append([]Option{WithKeyPairs([]byte("secret"))}, opts...)...)
+}
+
+var errConnRefused = errors.New("dial tcp: connection refused")
+
+func TestNewUnavailable(t *testing.T) {
+	s, db := newFakeStore(t)
+	db.setHandler(func(query string, args []driver.Value) (fakeResult, error) {
+		return fakeResult{}, errConnRefused
+	})
+	r := requestWithSession(t, s, "session", "5")
+	session, err := s.New(r, "session")
+	if !errors.Is(err, ErrStoreUnavailable) {
+		t.Fatalf("New = %v, want ErrStoreUnavailable", err)
+	}
+	if session.ID != "" || len(session.Values) != 0 {
+		t.Errorf("session has ID %q and values %v, want neither", session.ID, session.Values)
+	}
+
+	// the database recovered, but the session still doesn't hold the
+	// stored values
+	db.setHandler(nil)
+	session.Values["user"] = "alice"
+	if err := s.Save(r, httptest.NewRecorder(), session); !errors.Is(err, ErrStoreUnavailable) {
+		t.Errorf("Save = %v, want ErrStoreUnavailable", err)
+	}
+	if queries, _ := db.ran("INSERT"); len(queries) > 0 {
+		t.Errorf("Save inserted a row: %q", queries)
+	}
+	if queries, _ := db.ran("UPDATE"); len(queries) > 0 {
+		t.Errorf("Save updated a row: %q", queries)
+	}
+}
+
+func TestMaxAgeRebuildsCodecs(t *testing.T) {
+	s := testStore(t)
+	codecs := s.Codecs
+	s.MaxAge(60)
+	if s.Codecs[0] == codecs[0] {
+		t.Error("MaxAge changed the codecs in place")
+	}
+	if s.Options.MaxAge != 60 {
+		t.Errorf("MaxAge = %d, want 60", s.Options.MaxAge)
+	}
+
+	// without key pairs the codecs are shared with the caller
+	s.keyPairs = nil
+	custom := securecookie.CodecsFromPairs([]byte("custom"))
+	s.Codecs = custom
+	s.SetOptions(sessions.Options{MaxAge: 120})
+	s.MaxLength(100)
+	if s.Codecs[0] != custom[0] || s.Options.MaxAge != 120 {
+		t.Error("codecs without key pairs were replaced")
+	}
+}
+
+func TestNewOpen(t *testing.T) {
+	s, db := newFakeStore(t)
+	serveRow(t, s, db, map[interface{}]interface{}{"user": "alice"}, time.Now().Add(time.Hour))
+	session, err := s.New(requestWithSession(t, s, "session", "5"), "session")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if session.IsNew || session.ID != "5" || session.Values["user"] != "alice" {
+		t.Errorf("stored session loaded as %q %v, new %v", session.ID, session.Values, session.IsNew)
+	}
+	if queries, _ := db.ran("INSERT"); len(queries) != 0 {
+		t.Errorf("New inserted a stored session: %q", queries)
+	}
+}
+
+func TestNewReplaces(t *testing.T) {
+	bad := httptest.NewRequest(http.MethodGet, "/", nil)
+	bad.AddCookie(&http.Cookie{Name: "session", Value: "garbage"})
+
+	tests := []struct {
+		name string
+		r    func(*testing.T, *MariadbStore) *http.Request
+	}{
+		{"undecodable cookie", func(*testing.T, *MariadbStore) *http.Request { return bad }},
+		{"missing row", func(t *testing.T, s *MariadbStore) *http.Request { return requestWithSession(t, s, "session", "5") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newFakeStore(t)
+			session, err := s.New(tt.r(t, s), "session")
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if !session.IsNew || session.ID == "" || session.ID == "5" || len(session.Values) != 0 {
+				t.Errorf("session %q %v, new %v, want a new session", session.ID, session.Values, session.IsNew)
+			}
+			if queries, _ := db.ran("INSERT"); len(queries) != 1 {
+				t.Errorf("New inserted %d rows, want the new session's", len(queries))
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package mariadbstore
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/gorilla/sessions"
+)
+
+// defaultMaxTenants caps the tenant stores unless WithMaxTenants sets
+// another limit. Each one prepares its statements on every connection.
+const defaultMaxTenants = 100
+
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// tenants holds the stores of the tenants seen so far.
+type tenants struct {
+	resolve func(*http.Request) string
+	mu      sync.RWMutex
+	stores  map[string]*MariadbStore
+	// pending holds the stores being created, so requests of a new tenant
+	// wait for a single creation without blocking the other tenants.
+	pending map[string]*tenantInit
+}
+
+// tenantInit is the creation of a tenant's store.
+type tenantInit struct {
+	done  chan struct{}
+	store *MariadbStore
+	err   error
+}
+
+// cookieName returns the name cookies are signed with. Tenant stores sign
+// their cookies for the tenant, so a cookie issued to one tenant isn't
+// accepted by another whose table has a session with the same ID.
+func (s *MariadbStore) cookieName(name string) string {
+	if s.tenant == "" {
+		return name
+	}
+	return s.tenant + ":" + name
+}
+
+// storeFor returns the store of the tenant r belongs to.
+func (s *MariadbStore) storeFor(r *http.Request) (*MariadbStore, error) {
+	if s.tenants == nil {
+		return s, nil
+	}
+	return s.Tenant(s.tenants.resolve(r))
+}
+
+// unavailableTenant returns the session handed out when the store of the
+// request's tenant can't be created. Save refuses it, so it never ends up in
+// the table of s.
+func (s *MariadbStore) unavailableTenant(name string, st *sessionStore, err error) (*sessions.Session, error) {
+	err = fmt.Errorf("%w: %w", ErrTenantUnavailable, err)
+	st.MariadbStore = s
+	session := s.newSession(st, name)
+	reject(session, err)
+	return session, err
+}
+
+// Tenant returns the store of a tenant set up with WithTenantFunc, creating
+// its table the first time. Use it for per-tenant administration, e.g.
+// Tenant("acme").Stats(ctx). The empty tenant is the store itself. Tenant
+// names may only contain letters, digits and underscores.
+func (s *MariadbStore) Tenant(tenant string) (*MariadbStore, error) {
+	if s.tenants == nil || tenant == "" {
+		return s, nil
+	}
+	ts := s.tenants
+	ts.mu.RLock()
+	t, ok := ts.stores[tenant]
+	ts.mu.RUnlock()
+	if ok {
+		return t, nil
+	}
+
+	if !tenantPattern.MatchString(tenant) {
+		return nil, fmt.Errorf("invalid tenant %q", tenant)
+	}
+	if err := s.checkOpen(); err != nil {
+		return nil, err
+	}
+	if s.drain.isDraining() {
+		return nil, ErrStoreDraining
+	}
+
+	ts.mu.Lock()
+	if t, ok := ts.stores[tenant]; ok {
+		ts.mu.Unlock()
+		return t, nil
+	}
+	if p, ok := ts.pending[tenant]; ok {
+		ts.mu.Unlock()
+		<-p.done
+		return p.store, p.err
+	}
+	if len(ts.stores)+len(ts.pending) >= s.maxTenants {
+		ts.mu.Unlock()
+		return nil, fmt.Errorf("tenant %s: the limit of %d tenants is reached", tenant, s.maxTenants)
+	}
+	p := &tenantInit{done: make(chan struct{})}
+	ts.pending[tenant] = p
+	ts.mu.Unlock()
+
+	p.store, p.err = s.newTenant(tenant)
+
+	ts.mu.Lock()
+	delete(ts.pending, tenant)
+	if p.err == nil {
+		// settings changed while the store was created weren't passed on
+		// to it, so they're copied again
+		s.copySettings(p.store)
+		ts.stores[tenant] = p.store
+	}
+	ts.mu.Unlock()
+	close(p.done)
+	return p.store, p.err
+}
+
+func (s *MariadbStore) newTenant(tenant string) (*MariadbStore, error) {
+	opts := append(slices.Clone(s.opts), s.asTenant(tenant))
+	t, err := NewMariadbStoreWithOptions(s.db, s.databaseName, s.tableName+"_"+tenant, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", tenant, err)
+	}
+	// the store was closed while the tenant was created, so nothing closes
+	// the new store later
+	if s.closed.Load() {
+		t.Close()
+		return nil, ErrStoreClosed
+	}
+	return t, nil
+}
+
+// asTenant configures the store of a tenant like s, including the settings
+// changed since s was created.
+func (s *MariadbStore) asTenant(tenant string) Option {
+	return func(t *MariadbStore) error {
+		t.tenant = tenant
+		t.tenants = nil
+		t.ownedDB = nil
+		// creating a tenant's store is part of a request
+		t.asyncStartup = true
+		// every tenant's table needs a leader of its own
+		if t.cleanupLock != "" && t.cleanupLock == s.cleanupLock {
+			t.cleanupLock = tenantLockName(s.cleanupLock, tenant)
+		}
+		s.copySettings(t)
+		return nil
+	}
+}
+
+// copySettings copies the cookie options and codecs of s, which may have
+// changed since s was created, to the store of a tenant.
+func (s *MariadbStore) copySettings(t *MariadbStore) {
+	s.codecsMu.RLock()
+	defer s.codecsMu.RUnlock()
+	t.codecsMu.Lock()
+	defer t.codecsMu.Unlock()
+
+	opts := *s.Options
+	t.Options = &opts
+	t.Codecs = s.Codecs
+	t.keyPairs = s.keyPairs
+	t.rowCodecs = s.rowCodecs
+	t.maxLength = s.maxLength
+	t.named = nil
+	if s.named != nil {
+		t.named = make(map[string]*namedSession, len(s.named))
+		for name, n := range s.named {
+			copied := *n
+			t.named[name] = &copied
+		}
+	}
+}
+
+// tenantLockName derives the cleanup lock name of a tenant from the lock
+// name of the store.
+func tenantLockName(lockName, tenant string) string {
+	name := lockName + ":" + tenant
+	if len(name) <= maxLockNameLength {
+		return name
+	}
+	sum := sha1.Sum([]byte(name))
+	return "mariadbstore:cleanup:" + hex.EncodeToString(sum[:])
+}
+
+// eachTenant calls f with the store of every tenant created so far.
+func (s *MariadbStore) eachTenant(f func(t *MariadbStore)) {
+	if s.tenants == nil {
+		return
+	}
+	s.tenants.mu.RLock()
+	defer s.tenants.mu.RUnlock()
+	for _, t := range s.tenants.stores {
+		f(t)
+	}
+}
+
+// tenantOf returns the store that created session, if it's one of the
+// tenant stores of s.
+func (s *MariadbStore) tenantOf(session *sessions.Session) (*MariadbStore, bool) {
+	st := stateOf(session)
+	if s.tenants == nil || st == nil || st.MariadbStore == s || st.tenant == "" {
+		return nil, false
+	}
+	return st.MariadbStore, true
+}
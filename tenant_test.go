@@ -0,0 +1,146 @@
+package mariadbstore
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func tenantRequest(tenant string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Tenant", tenant)
+	return r
+}
+
+func newTenantStore(t *testing.T, opts ...Option) (*MariadbStore, *fakeDB) {
+	t.Helper()
+	return newFakeStore(t, append([]Option{WithTenantFunc(func(r *http.Request) string {
+		return r.Header.Get("X-Tenant")
+	})}, opts...)...)
+}
+
+func TestTenantCreation(t *testing.T) {
+	s, db := newTenantStore(t)
+
+	var wg sync.WaitGroup
+	stores := make([]*MariadbStore, 10)
+	for i := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stores[i], _ = s.Tenant("acme")
+		}()
+	}
+	wg.Wait()
+	for _, t2 := range stores {
+		if t2 == nil || t2 != stores[0] || t2 == s {
+			t.Fatalf("Tenant returned %p, want the tenant store %p", t2, stores[0])
+		}
+	}
+	if queries, _ := db.ran("CREATE TABLE IF NOT EXISTS `sessions`.`sessions_acme`"); len(queries) != 1 {
+		t.Errorf("tenant table was created %d times, want once", len(queries))
+	}
+
+	r := tenantRequest("acme")
+	session, err := s.New(r, "session")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if st := stateOf(session); st == nil || st.MariadbStore != stores[0] {
+		t.Error("session of the tenant isn't bound to the tenant store")
+	}
+	if err := s.Save(r, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if queries, _ := db.ran("INSERT INTO `sessions`.`sessions_acme`"); len(queries) != 1 {
+		t.Errorf("session was inserted %d times into the tenant table, want once", len(queries))
+	}
+
+	if t2, err := s.Tenant(""); err != nil || t2 != s {
+		t.Errorf("Tenant(\"\") = %p, %v, want the store itself", t2, err)
+	}
+}
+
+func TestTenantLimits(t *testing.T) {
+	s, db := newTenantStore(t, WithMaxTenants(2))
+	a, err := s.Tenant("a")
+	if err != nil {
+		t.Fatalf("Tenant(a): %v", err)
+	}
+	for _, name := range []string{"a-b", "a.b", "a`b"} {
+		if _, err := s.Tenant(name); err == nil {
+			t.Errorf("Tenant(%q) succeeded", name)
+		}
+	}
+	if _, err := s.Tenant("b"); err != nil {
+		t.Fatalf("Tenant(b): %v", err)
+	}
+	if _, err := s.Tenant("c"); err == nil {
+		t.Error("tenant past the limit was created")
+	}
+	if t2, err := s.Tenant("a"); err != nil || t2 != a {
+		t.Errorf("Tenant(a) at the limit = %p, %v, want the existing store", t2, err)
+	}
+	if queries, _ := db.ran("CREATE TABLE"); len(queries) != 3 {
+		t.Errorf("created %d tables, want the store's and two tenants'", len(queries))
+	}
+}
+
+func TestTenantUnavailable(t *testing.T) {
+	s, db := newTenantStore(t, WithMaxTenants(1))
+	if _, err := s.Tenant("acme"); err != nil {
+		t.Fatalf("Tenant: %v", err)
+	}
+
+	for _, tenant := range []string{"globex", "not-a-name"} {
+		r := tenantRequest(tenant)
+		session, err := s.New(r, "session")
+		if !errors.Is(err, ErrTenantUnavailable) {
+			t.Fatalf("New for tenant %q = %v, want ErrTenantUnavailable", tenant, err)
+		}
+		session.Values["user"] = "alice"
+		if err := s.Save(r, httptest.NewRecorder(), session); !errors.Is(err, ErrTenantUnavailable) {
+			t.Errorf("Save for tenant %q = %v, want ErrTenantUnavailable", tenant, err)
+		}
+		if _, err := s.GetLocked(r.Context(), r, "session"); !errors.Is(err, ErrTenantUnavailable) {
+			t.Errorf("GetLocked for tenant %q = %v, want ErrTenantUnavailable", tenant, err)
+		}
+	}
+
+	if queries, _ := db.ran("`sessions`.`sessions_globex`"); len(queries) != 0 {
+		t.Errorf("tenant over the limit has a table: %q", queries)
+	}
+	if queries, _ := db.ran("INSERT INTO `sessions`.`sessions` "); len(queries) != 0 {
+		t.Errorf("session of an unavailable tenant was stored in the store's table: %q", queries)
+	}
+}
+
+func TestTenantGet(t *testing.T) {
+	s, db := newTenantStore(t)
+	r := tenantRequest("acme")
+	session, err := s.Get(r, "session")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	session.Values["user"] = "alice"
+	if err := session.Save(r, httptest.NewRecorder()); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if queries, _ := db.ran("INSERT INTO `sessions`.`sessions_acme`"); len(queries) != 1 {
+		t.Errorf("session was inserted %d times into the tenant table, want once", len(queries))
+	}
+	if queries, _ := db.ran("INSERT INTO `sessions`.`sessions` "); len(queries) != 0 {
+		t.Errorf("tenant session was stored in the store's table: %q", queries)
+	}
+
+	r = tenantRequest("not-a-name")
+	session, err = s.Get(r, "session")
+	if !errors.Is(err, ErrTenantUnavailable) {
+		t.Fatalf("Get = %v, want ErrTenantUnavailable", err)
+	}
+	if err := session.Save(r, httptest.NewRecorder()); !errors.Is(err, ErrTenantUnavailable) {
+		t.Errorf("Save = %v, want ErrTenantUnavailable", err)
+	}
+}
@@ -0,0 +1,20 @@
+package mariadbstore
+
+import "context"
+
+type cleanupKey struct{}
+
+// withCleanupScope marks ctx as belonging to a cleanup run, whose queries are
+// bounded by the cleanup timeout instead of the query timeout.
+func withCleanupScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cleanupKey{}, true)
+}
+
+// queryContext bounds a single query by the timeout set with
+// WithQueryTimeout.
+func (s *MariadbStore) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout <= 0 || ctx.Value(cleanupKey{}) != nil {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
@@ -0,0 +1,34 @@
+package mariadbstore
+
+import (
+	"context"
+	"database/sql"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/agorman/mariadbstore"
+
+// startSpan starts a span for a store operation. When stmt is set the span
+// describes the query it runs.
+func (s *MariadbStore) startSpan(ctx context.Context, name string, stmt *sql.Stmt) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "mariadb"),
+		attribute.String("db.name", s.databaseName),
+		attribute.String("db.sql.table", s.tableName),
+	}
+	if stmt != nil {
+		attrs = append(attrs, attribute.String("db.statement", s.queries[stmt]))
+	}
+	return s.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,166 @@
+package mariadbstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+type txKey struct{}
+
+// txScope is the transaction the store's queries run in.
+type txScope struct {
+	tx *sql.Tx
+	// lock loads the session row with SELECT ... FOR UPDATE.
+	lock bool
+}
+
+func withTx(ctx context.Context, tx *sql.Tx, lock bool) context.Context {
+	return context.WithValue(ctx, txKey{}, txScope{tx: tx, lock: lock})
+}
+
+func txFrom(ctx context.Context) (txScope, bool) {
+	scope, ok := ctx.Value(txKey{}).(txScope)
+	return scope, ok
+}
+
+// cachePut caches a written row. Rows written in a transaction may still be
+// rolled back, so they are evicted instead.
+func (s *MariadbStore) cachePut(ctx context.Context, id string, row sessionRow, now time.Time) {
+	if _, ok := txFrom(ctx); ok {
+		s.cache.remove(id)
+		return
+	}
+	s.cache.put(id, row, now)
+}
+
+// stmt returns the prepared statement bound to the transaction in ctx, if
+// there is one.
+func (s *MariadbStore) stmt(ctx context.Context, stmt *sql.Stmt) *sql.Stmt {
+	if scope, ok := txFrom(ctx); ok {
+		return scope.tx.StmtContext(ctx, stmt)
+	}
+	return stmt
+}
+
+// GetLocked loads the named session inside a transaction, locking its row
+// with SELECT ... FOR UPDATE so concurrent requests for the same session
+// wait for each other instead of overwriting each other's changes. The lock
+// is released when the session is saved, or by Unlock if it isn't. Sessions
+// returned by GetLocked aren't shared through the request registry.
+func (s *MariadbStore) GetLocked(ctx context.Context, r *http.Request, name string) (session *sessions.Session, err error) {
+	t, err := s.storeFor(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTenantUnavailable, err)
+	}
+	if t != s {
+		return t.GetLocked(ctx, r, name)
+	}
+	ctx, span := s.startSpan(ctx, "mariadbstore.GetLocked", nil)
+	defer func() { endSpan(span, err) }()
+
+	if err := s.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return nil, s.dbError(ctx, "begin", "", err)
+	}
+
+	session = s.newSession(&sessionStore{MariadbStore: s, tx: tx}, name)
+	err = s.open(withTx(ctx, tx, true), r, session)
+	// replaced sessions are reported but stay locked like any other
+	if err != nil && !errors.Is(err, ErrSessionHijackSuspected) && !errors.Is(err, ErrBadCookie) {
+		s.unlock(session)
+	}
+	return session, err
+}
+
+// NewTx is like New but reads and creates the session through tx, so the new
+// row is only stored if the caller commits tx.
+func (s *MariadbStore) NewTx(ctx context.Context, tx *sql.Tx, r *http.Request, name string) (session *sessions.Session, err error) {
+	t, err := s.storeFor(r)
+	if err != nil {
+		return s.unavailableTenant(name, &sessionStore{}, err)
+	}
+	if t != s {
+		return t.NewTx(ctx, tx, r, name)
+	}
+	ctx, span := s.startSpan(ctx, "mariadbstore.NewTx", nil)
+	defer func() { endSpan(span, err) }()
+
+	session = s.newSession(&sessionStore{MariadbStore: s}, name)
+	if err := s.checkOpen(); err != nil {
+		return session, err
+	}
+	return session, s.open(withTx(ctx, tx, false), r, session)
+}
+
+// SaveTx is like Save but writes the session through tx, so it is committed
+// or rolled back together with the caller's other changes. The cookie is set
+// before tx is committed.
+func (s *MariadbStore) SaveTx(ctx context.Context, tx *sql.Tx, r *http.Request, w http.ResponseWriter, session *sessions.Session) (err error) {
+	if t, ok := s.tenantOf(session); ok {
+		return t.SaveTx(ctx, tx, r, w, session)
+	}
+	ctx, span := s.startSpan(ctx, "mariadbstore.SaveTx", nil)
+	defer func() { endSpan(span, err) }()
+
+	if err := s.checkOpen(); err != nil {
+		return err
+	}
+	if err := rejected(session); err != nil {
+		return err
+	}
+	if err := s.drain.beginWrite(); err != nil {
+		return err
+	}
+	defer s.drain.endWrite()
+	ctx = s.withClient(ctx, r)
+	ctx = s.withSecure(ctx, r)
+
+	return s.write(withTx(ctx, tx, false), w, session)
+}
+
+// Unlock releases the lock taken by GetLocked without saving the session.
+// It does nothing if the session isn't locked.
+func (s *MariadbStore) Unlock(session *sessions.Session) error {
+	return s.unlock(session)
+}
+
+// commit commits the transaction of a locked session.
+func (s *MariadbStore) commit(session *sessions.Session) error {
+	st := stateOf(session)
+	if st == nil || st.tx == nil {
+		return nil
+	}
+	tx := st.tx
+	st.tx = nil
+	if err := tx.Commit(); err != nil {
+		s.cache.remove(session.ID)
+		return s.dbError(context.Background(), "commit", session.ID, err)
+	}
+	return nil
+}
+
+// unlock rolls back the transaction of a locked session. Anything cached
+// while it was open is dropped since it was never committed.
+func (s *MariadbStore) unlock(session *sessions.Session) error {
+	st := stateOf(session)
+	if st == nil || st.tx == nil {
+		return nil
+	}
+	tx := st.tx
+	st.tx = nil
+	s.cache.remove(session.ID)
+	if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return s.dbError(context.Background(), "rollback", session.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package mariadbstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// SessionLimitPolicy decides what happens when a user exceeds the limit set
+// with WithMaxSessionsPerUser.
+type SessionLimitPolicy int
+
+const (
+	// RejectNewSessions fails the save that would exceed the limit with
+	// ErrTooManySessions.
+	RejectNewSessions SessionLimitPolicy = iota
+	// EvictOldestSessions deletes the user's oldest sessions to make room.
+	EvictOldestSessions
+)
+
+// SetUserID associates session with a user, e.g. after logging in. The
+// association is stored when the session is saved by a store created with
+// WithMaxSessionsPerUser. It does nothing for sessions of other stores.
+func SetUserID(session *sessions.Session, userID string) {
+	if st := stateOf(session); st != nil {
+		st.userID = userID
+	}
+}
+
+// UserID returns the user associated with session, if any.
+func UserID(session *sessions.Session) string {
+	if st := stateOf(session); st != nil {
+		return st.userID
+	}
+	return ""
+}
+
+// claimsUser reports whether saving session associates it with a new user,
+// which is when the session limit is enforced.
+func (s *MariadbStore) claimsUser(session *sessions.Session) bool {
+	st := stateOf(session)
+	return s.maxPerUser > 0 && st != nil && st.userID != "" && st.userID != st.storedUserID
+}
+
+// persistForUser stores a session that is being associated with a user. The
+// user's sessions are locked while the limit is checked so concurrent logins
+// can't exceed it.
+func (s *MariadbStore) persistForUser(ctx context.Context, session *sessions.Session) error {
+	if _, ok := txFrom(ctx); ok {
+		if err := s.enforceUserLimit(ctx, session); err != nil {
+			return err
+		}
+		return s.persist(ctx, session)
+	}
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return s.dbError(ctx, "begin", session.ID, err)
+	}
+	id := session.ID
+	txCtx := withTx(ctx, tx, false)
+	err = s.enforceUserLimit(txCtx, session)
+	if err == nil {
+		err = s.persist(txCtx, session)
+	}
+	if err != nil {
+		tx.Rollback()
+		s.cache.remove(session.ID)
+		// a row inserted by the rolled back transaction doesn't exist
+		session.ID = id
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		s.cache.remove(session.ID)
+		return s.dbError(ctx, "commit", session.ID, err)
+	}
+	return nil
+}
+
+func (s *MariadbStore) enforceUserLimit(ctx context.Context, session *sessions.Session) error {
+	userID := stateOf(session).userID
+	rows, err := s.queryStmt(ctx, s.userStmt, userID, time.Now().Unix(), session.ID)
+	if err != nil {
+		return s.dbError(ctx, "user sessions", session.ID, err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return s.dbError(ctx, "user sessions", session.ID, err)
+	}
+
+	excess := len(ids) - s.maxPerUser + 1
+	if excess <= 0 {
+		return nil
+	}
+	if s.limitPolicy == RejectNewSessions {
+		return ErrTooManySessions
+	}
+
+	// ids are ordered oldest first
+	for _, id := range ids[:excess] {
+		if err := s.erase(ctx, id); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package mariadbstore
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/gorilla/sessions"
+)
+
+// Get returns the session value stored under key as a T. Values that come
+// back from the serializer as another type, e.g. numbers as float64 with
+// JSONSerializer or structs as maps, are converted through JSON. It reports
+// false if there is no such value or it can't be converted.
+func Get[T any](session *sessions.Session, key any) (T, bool) {
+	var t T
+	v, ok := session.Values[key]
+	if !ok {
+		return t, false
+	}
+	if t, ok := v.(T); ok {
+		return t, true
+	}
+	if err := convert(v, &t); err != nil {
+		return t, false
+	}
+	return t, true
+}
+
+// Set stores value under key. Struct types are registered with encoding/gob,
+// which the default and gob serializers need to encode them.
+func Set[T any](session *sessions.Session, key any, value T) {
+	register(value)
+	session.Values[key] = value
+}
+
+// Delete removes the value stored under key.
+func Delete(session *sessions.Session, key any) {
+	delete(session.Values, key)
+}
+
+// BindValues copies session values into the exported fields of the struct
+// dst points to. A field is read from the value named by its `session` tag,
+// or by the field name without one; fields tagged "-" are skipped. Values are
+// converted like Get does.
+func BindValues(session *sessions.Session, dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("BindValues needs a pointer to a struct")
+	}
+	v = v.Elem()
+
+	for i := 0; i < v.NumField(); i++ {
+		key, ok := valueKey(v.Type().Field(i))
+		if !ok {
+			continue
+		}
+		value, ok := session.Values[key]
+		if !ok || value == nil {
+			continue
+		}
+
+		field := v.Field(i)
+		if rv := reflect.ValueOf(value); rv.Type().AssignableTo(field.Type()) {
+			field.Set(rv)
+			continue
+		}
+		if err := convert(value, field.Addr().Interface()); err != nil {
+			return fmt.Errorf("session value %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// SetValues stores the exported fields of the struct src, or src points to,
+// as session values, using the keys BindValues reads them from.
+func SetValues(session *sessions.Session, src any) error {
+	v := reflect.Indirect(reflect.ValueOf(src))
+	if v.Kind() != reflect.Struct {
+		return errors.New("SetValues needs a struct")
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		key, ok := valueKey(v.Type().Field(i))
+		if !ok {
+			continue
+		}
+		value := v.Field(i).Interface()
+		register(value)
+		session.Values[key] = value
+	}
+	return nil
+}
+
+// valueKey returns the session value key of a struct field.
+func valueKey(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	switch tag := f.Tag.Get("session"); tag {
+	case "-":
+		return "", false
+	case "":
+		return f.Name, true
+	default:
+		return tag, true
+	}
+}
+
+// convert converts a value decoded by any serializer to the type dst points
+// to.
+func convert(v any, dst any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
+
+// register makes struct values encodable with gob when they are stored in the
+// session's interface values.
+func register(value any) {
+	t := reflect.TypeOf(value)
+	if t == nil {
+		return
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		// gob panics if the application registered the type under
+		// another name, which works just as well
+		defer func() { recover() }()
+		gob.Register(value)
+	}
+}
@@ -0,0 +1,124 @@
+package mariadbstore
+
+import (
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+type testProfile struct {
+	Name  string
+	Roles []string
+}
+
+func newValuesSession(values map[interface{}]interface{}) *sessions.Session {
+	session := sessions.NewSession(nil, "session")
+	session.Values = values
+	return session
+}
+
+func TestGet(t *testing.T) {
+	session := newValuesSession(map[interface{}]interface{}{
+		"user":  "alice",
+		"count": float64(3),
+		// a struct decoded by JSONSerializer
+		"profile": map[string]interface{}{"Name": "Alice", "Roles": []interface{}{"admin"}},
+		1:         "int key",
+	})
+
+	if user, ok := Get[string](session, "user"); !ok || user != "alice" {
+		t.Errorf("Get[string](user) = %q, %v", user, ok)
+	}
+	if count, ok := Get[int](session, "count"); !ok || count != 3 {
+		t.Errorf("Get[int](count) = %d, %v, want the float converted", count, ok)
+	}
+	if p, ok := Get[testProfile](session, "profile"); !ok || p.Name != "Alice" || len(p.Roles) != 1 || p.Roles[0] != "admin" {
+		t.Errorf("Get[testProfile](profile) = %+v, %v, want the map converted", p, ok)
+	}
+	if v, ok := Get[string](session, 1); !ok || v != "int key" {
+		t.Errorf("Get[string](1) = %q, %v", v, ok)
+	}
+	if v, ok := Get[string](session, "missing"); ok || v != "" {
+		t.Errorf("Get of a missing value = %q, %v, want false", v, ok)
+	}
+	if v, ok := Get[int](session, "user"); ok || v != 0 {
+		t.Errorf("Get[int] of a string = %d, %v, want false", v, ok)
+	}
+}
+
+func TestSetAndDelete(t *testing.T) {
+	session := newValuesSession(map[interface{}]interface{}{})
+	Set(session, "profile", testProfile{Name: "Alice"})
+	if p, ok := Get[testProfile](session, "profile"); !ok || p.Name != "Alice" {
+		t.Errorf("Get after Set = %+v, %v", p, ok)
+	}
+	Delete(session, "profile")
+	if _, ok := session.Values["profile"]; ok {
+		t.Error("Delete left the value")
+	}
+}
+
+func TestBindValues(t *testing.T) {
+	session := newValuesSession(map[interface{}]interface{}{
+		"user_id": float64(42),
+		"Name":    "alice",
+		"Roles":   []interface{}{"admin", "dev"},
+		"Secret":  "hidden",
+		"hidden":  "unexported",
+		"Nil":     nil,
+	})
+	var dst struct {
+		UserID int `session:"user_id"`
+		Name   string
+		Roles  []string
+		Secret string `session:"-"`
+		Nil    string
+		Absent string
+		hidden string
+	}
+	dst.Nil = "kept"
+	if err := BindValues(session, &dst); err != nil {
+		t.Fatalf("BindValues: %v", err)
+	}
+	if dst.UserID != 42 || dst.Name != "alice" || len(dst.Roles) != 2 || dst.Roles[1] != "dev" {
+		t.Errorf("bound %+v", dst)
+	}
+	if dst.Secret != "" || dst.hidden != "" || dst.Absent != "" || dst.Nil != "kept" {
+		t.Errorf("skipped fields were set: %+v", dst)
+	}
+
+	var bad struct {
+		UserID int `session:"Name"`
+	}
+	if err := BindValues(session, &bad); err == nil {
+		t.Error("BindValues converted a string to an int")
+	}
+	if err := BindValues(session, dst); err == nil {
+		t.Error("BindValues accepted a struct that isn't a pointer")
+	}
+	var s *struct{ Name string }
+	if err := BindValues(session, s); err == nil {
+		t.Error("BindValues accepted a nil pointer")
+	}
+}
+
+func TestSetValues(t *testing.T) {
+	session := newValuesSession(map[interface{}]interface{}{})
+	src := struct {
+		UserID int `session:"user_id"`
+		Name   string
+		Secret string `session:"-"`
+	}{UserID: 7, Name: "bob", Secret: "x"}
+	if err := SetValues(session, &src); err != nil {
+		t.Fatalf("SetValues: %v", err)
+	}
+	if session.Values["user_id"] != 7 || session.Values["Name"] != "bob" {
+		t.Errorf("values %v", session.Values)
+	}
+	if _, ok := session.Values["Secret"]; ok {
+		t.Error("SetValues stored a field tagged -")
+	}
+	if err := SetValues(session, "not a struct"); err == nil {
+		t.Error("SetValues accepted a string")
+	}
+}
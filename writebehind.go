@@ -0,0 +1,188 @@
+package mariadbstore
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxWriteBehindBatch keeps a batched UPDATE, with up to 13 placeholders per
+// session, below the 65535 placeholders a statement can have.
+const maxWriteBehindBatch = 5000
+
+// writeBehind collects expiry refreshes until they are written in batches.
+type writeBehind struct {
+	interval time.Duration
+	maxBatch int
+
+	mu sync.Mutex
+	// pending holds the touched columns' values by session ID. Later
+	// refreshes of a session replace earlier ones.
+	pending map[string][]any
+
+	full chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newWriteBehind(interval time.Duration, maxBatch int) *writeBehind {
+	return &writeBehind{
+		interval: interval,
+		maxBatch: maxBatch,
+		pending:  make(map[string][]any),
+		full:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (wb *writeBehind) add(id string, values []any) {
+	wb.mu.Lock()
+	wb.pending[id] = values
+	full := len(wb.pending) >= wb.maxBatch
+	wb.mu.Unlock()
+
+	if full {
+		select {
+		case wb.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// drop forgets the pending refresh of a session that is saved or deleted.
+func (wb *writeBehind) drop(id string) {
+	wb.mu.Lock()
+	delete(wb.pending, id)
+	wb.mu.Unlock()
+}
+
+func (wb *writeBehind) take() map[string][]any {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	pending := wb.pending
+	wb.pending = make(map[string][]any)
+	return pending
+}
+
+// requeue puts back refreshes that couldn't be written, unless the session
+// was refreshed again in the meantime.
+func (wb *writeBehind) requeue(pending map[string][]any) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	for id, values := range pending {
+		if _, ok := wb.pending[id]; !ok {
+			wb.pending[id] = values
+		}
+	}
+}
+
+// touchColumns lists the columns set by touchStmt, in the order of its
+// arguments. It must match metaColumns(false).
+func (s *MariadbStore) touchColumns() []string {
+	columns := []string{"{last_active}", "{expires}"}
+	if s.metadata {
+		columns = append(columns, "{client_ip}", "{user_agent}")
+	}
+	if s.persistOptions {
+		columns = append(columns, "{options}")
+	}
+	return columns
+}
+
+func (s *MariadbStore) flushLoop() {
+	wb := s.behind
+	t := time.NewTicker(wb.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-wb.full:
+		case <-wb.stop:
+			close(wb.done)
+			return
+		}
+		if err := s.flush(s.sweepCtx); err != nil {
+			s.log(s.sweepCtx, s.logLevels.DB, "session write-behind flush failed", "error", err)
+		}
+	}
+}
+
+// Flush writes the expiry refreshes held back by WithWriteBehind. It does
+// nothing without write-behind.
+func (s *MariadbStore) Flush(ctx context.Context) error {
+	if s.behind == nil {
+		return nil
+	}
+	if err := s.checkOpen(); err != nil {
+		return err
+	}
+	return s.flush(ctx)
+}
+
+func (s *MariadbStore) flush(ctx context.Context) error {
+	pending := s.behind.take()
+	ids := make([]string, 0, len(pending))
+	for id := range pending {
+		ids = append(ids, id)
+	}
+
+	for len(ids) > 0 {
+		batch := ids[:min(len(ids), s.behind.maxBatch)]
+		err := s.guard(ctx, func() error {
+			if err := s.flushBatch(ctx, batch, pending); err != nil {
+				return s.dbError(ctx, "flush", "", err)
+			}
+			return nil
+		})
+		if err != nil {
+			s.behind.requeue(pending)
+			return err
+		}
+		for _, id := range batch {
+			delete(pending, id)
+		}
+		ids = ids[len(batch):]
+	}
+	return nil
+}
+
+// flushBatch refreshes several sessions with a single UPDATE, setting each
+// column with a CASE on the session ID. Sessions saved since their refresh
+// was queued are skipped, so the refresh doesn't roll back their expiry.
+func (s *MariadbStore) flushBatch(ctx context.Context, ids []string, pending map[string][]any) error {
+	var query strings.Builder
+	var args []any
+	cases := func(i int) {
+		query.WriteString("CASE {id}")
+		for _, id := range ids {
+			query.WriteString(" WHEN ? THEN ?")
+			args = append(args, id, pending[id][i])
+		}
+		query.WriteString(" END")
+	}
+
+	query.WriteString("UPDATE {table} SET ")
+	for i, column := range s.touchColumns() {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString(column + " = ")
+		cases(i)
+	}
+	query.WriteString(" WHERE {id} IN (?" + strings.Repeat(", ?", len(ids)-1) + "){live}")
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	// the first touched column is {last_active}
+	query.WriteString(" AND {last_active} < ")
+	cases(0)
+
+	_, err := s.retrying(ctx, true, func() (sql.Result, error) {
+		return s.execQuery(ctx, query.String(), args...)
+	})
+	return err
+}
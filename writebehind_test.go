@@ -0,0 +1,69 @@
+package mariadbstore
+
+import (
+	"context"
+	"database/sql/driver"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFlushBatch(t *testing.T) {
+	s, db := newFakeStore(t, WithWriteBehind(time.Hour, 100))
+	pending := map[string][]any{
+		"1": {int64(10), int64(110)},
+		"2": {int64(20), int64(120)},
+	}
+	if err := s.flushBatch(context.Background(), []string{"1", "2"}, pending); err != nil {
+		t.Fatalf("flushBatch: %v", err)
+	}
+
+	queries, args := db.ran("UPDATE")
+	if len(queries) != 1 {
+		t.Fatalf("ran %q, want a single UPDATE", queries)
+	}
+	want := "UPDATE `sessions`.`sessions` SET " +
+		"`last_active` = CASE `id` WHEN ? THEN ? WHEN ? THEN ? END, " +
+		"`expires` = CASE `id` WHEN ? THEN ? WHEN ? THEN ? END " +
+		"WHERE `id` IN (?, ?) AND `last_active` < CASE `id` WHEN ? THEN ? WHEN ? THEN ? END"
+	if queries[0] != want {
+		t.Errorf("query\n%s\nwant\n%s", queries[0], want)
+	}
+	wantArgs := []driver.Value{
+		"1", int64(10), "2", int64(20),
+		"1", int64(110), "2", int64(120),
+		"1", "2",
+		"1", int64(10), "2", int64(20),
+	}
+	if !slices.Equal(args[0], wantArgs) {
+		t.Errorf("args %v, want %v", args[0], wantArgs)
+	}
+}
+
+func TestFlushRequeues(t *testing.T) {
+	s, db := newFakeStore(t, WithWriteBehind(time.Hour, 100))
+	s.behind.add("1", []any{int64(10), int64(110)})
+	db.setHandler(func(query string, args []driver.Value) (fakeResult, error) {
+		return fakeResult{}, errConnRefused
+	})
+	if err := s.Flush(context.Background()); err == nil {
+		t.Fatal("Flush succeeded with the database down")
+	}
+
+	failed, _ := db.ran("UPDATE")
+
+	db.setHandler(nil)
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	queries, args := db.ran("UPDATE")
+	if len(queries) != len(failed)+1 {
+		t.Fatalf("second Flush ran %d updates, want the requeued refresh once", len(queries)-len(failed))
+	}
+	if last := args[len(args)-1]; !slices.Contains(last, driver.Value("1")) || !slices.Contains(last, driver.Value(int64(110))) {
+		t.Errorf("requeued refresh was written with %v", last)
+	}
+	if len(s.behind.take()) != 0 {
+		t.Error("written refresh is still pending")
+	}
+}